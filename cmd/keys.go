@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"authforge/config"
+	"authforge/internal/keyring"
+	"authforge/internal/logger"
+	"authforge/internal/models"
+	"authforge/internal/repository"
+	"authforge/internal/tokenformat"
+)
+
+const keysUsage = `usage: authforge keys <command>
+
+commands:
+  generate [-alg ES256] [-activate]  create a new signing key
+  list                               show all stored keys
+  rotate [kid]                       make a key the active signing key (default: newest pending key)
+  retire <kid>                       stop trusting a key that no longer signs
+  purge                              delete retired keys`
+
+// Keys manages the signing keys stored in Postgres. Running servers pick up
+// changes within KEY_RELOAD_INTERVAL, or immediately on SIGHUP.
+func Keys(args []string) {
+	logger.Init()
+
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, keysUsage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadConfig(".")
+	if err != nil {
+		logger.Error("Error loading config: ", err)
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	db, err := repository.NewPostgresDB(cfg)
+	if err != nil {
+		logger.Error("Error connecting to database: ", err)
+		log.Fatalf("Error connecting to database: %v", err)
+	}
+	defer db.Close()
+
+	repo := repository.NewSigningKeyRepository(db)
+
+	switch args[0] {
+	case "generate":
+		err = generateKey(cfg, repo, args[1:])
+	case "list":
+		err = listKeys(repo)
+	case "rotate":
+		err = rotateKey(repo, args[1:])
+	case "retire":
+		err = retireKey(repo, args[1:])
+	case "purge":
+		err = purgeKeys(repo)
+	default:
+		fmt.Fprintln(os.Stderr, keysUsage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("keys %s: %v", args[0], err)
+	}
+}
+
+func generateKey(cfg *config.Config, repo repository.SigningKeyRepository, args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	alg := flags.String("alg", "ES256", "signing algorithm: "+strings.Join(keyring.Algorithms, ", "))
+	activate := flags.Bool("activate", false, "make the key active right away instead of leaving it pending")
+	flags.Parse(args)
+
+	if !slices.Contains(keyring.Algorithms, *alg) {
+		return fmt.Errorf("unsupported algorithm %q", *alg)
+	}
+
+	key, err := keyring.Generate(*alg)
+	if err != nil {
+		return err
+	}
+	stored, err := keyring.Seal(cfg.KeyEncryptionKey, key)
+	if err != nil {
+		return err
+	}
+	if err := repo.CreateKey(stored); err != nil {
+		return err
+	}
+	fmt.Println("Generated", key.Algorithm, "key", key.ID)
+
+	if *activate {
+		return rotateKey(repo, []string{key.ID})
+	}
+	return nil
+}
+
+func listKeys(repo repository.SigningKeyRepository) error {
+	keys, err := repo.ListKeys()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KID\tALG\tSTATUS\tCREATED\tACTIVATED\tRETIRED")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			key.ID, key.Algorithm, key.Status,
+			key.CreatedAt.Format(time.RFC3339), formatTime(key.ActivatedAt), formatTime(key.RetiredAt))
+	}
+	return w.Flush()
+}
+
+func rotateKey(repo repository.SigningKeyRepository, args []string) error {
+	var kid string
+	if len(args) > 0 {
+		kid = args[0]
+	} else {
+		keys, err := repo.ListKeys()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if key.Status == models.SigningKeyPending {
+				kid = key.ID
+			}
+		}
+		if kid == "" {
+			return fmt.Errorf("no pending key to rotate to, run authforge keys generate first")
+		}
+	}
+
+	ok, err := repo.ActivateKey(kid)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("key %s does not exist or is retired", kid)
+	}
+	fmt.Println("Key", kid, "is now the active signing key")
+	return nil
+}
+
+func retireKey(repo repository.SigningKeyRepository, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: authforge keys retire <kid>")
+	}
+
+	ok, err := repo.RetireKey(args[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("key %s does not exist, is already retired or is the active key", args[0])
+	}
+	fmt.Println("Key", args[0], "retired; tokens it signed are no longer accepted")
+	return nil
+}
+
+func purgeKeys(repo repository.SigningKeyRepository) error {
+	n, err := repo.PurgeRetiredKeys()
+	if err != nil {
+		return err
+	}
+	fmt.Println("Purged", n, "retired keys")
+	return nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func loadKeyring(cfg *config.Config, repo repository.SigningKeyRepository) (*keyring.Keyring, error) {
+	stored, err := repo.ListKeys()
+	if err != nil {
+		return nil, err
+	}
+	return keyring.Load(cfg, stored)
+}
+
+// watchKeys reloads the keyring from Postgres every KEY_RELOAD_INTERVAL and on
+// SIGHUP. A failed reload, or one whose active key cannot sign in
+// TOKEN_FORMAT, keeps the current keys.
+func watchKeys(cfg *config.Config, db *sql.DB, keys *keyring.Keyring) {
+	repo := repository.NewSigningKeyRepository(db)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if cfg.KeyReloadInterval > 0 {
+		ticker := time.NewTicker(cfg.KeyReloadInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-hup:
+			logger.Info("SIGHUP received, reloading signing keys")
+		case <-tick:
+		}
+
+		reloaded, err := loadKeyring(cfg, repo)
+		if err != nil {
+			logger.Error("Error reloading signing keys: ", err)
+			continue
+		}
+		if err := tokenformat.CheckSigningKey(cfg.TokenFormat, reloaded); err != nil {
+			logger.Error("Keeping the current signing keys: ", err)
+			continue
+		}
+		if active := keys.SigningKey(); active.ID != reloaded.SigningKey().ID {
+			logger.Info("Active signing key changed from ", active.ID, " to ", reloaded.SigningKey().ID)
+		}
+		keys.Replace(reloaded)
+	}
+}
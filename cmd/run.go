@@ -3,14 +3,17 @@ package cmd
 import (
 	"log"
 	"net/http"
+	"time"
 
 	"authforge/config"
 	"authforge/internal/api/handlers"
 	"authforge/internal/api/handlers/routes"
+	"authforge/internal/dpop"
 	"authforge/internal/logger"
 	"authforge/internal/mailer"
 	"authforge/internal/repository"
 	"authforge/internal/services"
+	"authforge/internal/tokenformat"
 )
 
 func Run() {
@@ -28,19 +31,63 @@ func Run() {
 		log.Fatalf("Error connecting to database: %v", err)
 	}
 
+	keys, err := loadKeyring(cfg, repository.NewSigningKeyRepository(db))
+	if err != nil {
+		logger.Error("Error loading signing keys: ", err)
+		log.Fatalf("Error loading signing keys: %v", err)
+	}
+	go watchKeys(cfg, db, keys)
+
+	format, err := tokenformat.New(cfg.TokenFormat, keys)
+	if err != nil {
+		logger.Error("Error configuring token format: ", err)
+		log.Fatalf("Error configuring token format: %v", err)
+	}
+	if keys.SigningKey().IsSymmetric() {
+		logger.Info("ID tokens are disabled while JWT_SECRET is the active key; configure JWT_KEYS_DIR or a stored key to act as an OpenID provider")
+	}
+
 	userRepo := repository.NewUserRepository(db)
 	tokenRepo := repository.NewConfirmationTokenRepository(db)
 	passwordResetTokenRepo := repository.NewPasswordResetTokenRepository(db)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	revokedTokenRepo := repository.NewRevokedTokenRepository(db)
+	opaqueTokenRepo := repository.NewOpaqueTokenRepository(db)
+	oauthClientRepo := repository.NewOAuthClientRepository(db)
+	authorizationCodeRepo := repository.NewAuthorizationCodeRepository(db)
+	deviceCodeRepo := repository.NewDeviceCodeRepository(db)
+	emailChangeTokenRepo := repository.NewEmailChangeTokenRepository(db)
+	auditEventRepo := repository.NewAuditEventRepository(db)
+	dataExportRepo := repository.NewDataExportRepository(db)
 
 	smtpMailer := mailer.NewSMTPMailer(cfg)
 
-	authService := services.NewAuthService(userRepo, tokenRepo, passwordResetTokenRepo, cfg, smtpMailer)
+	authService := services.NewAuthService(userRepo, tokenRepo, passwordResetTokenRepo, refreshTokenRepo, sessionRepo, revokedTokenRepo, opaqueTokenRepo, oauthClientRepo, auditEventRepo, keys, format, dpop.NewVerifier(cfg.DPoPNonce), cfg, smtpMailer)
+	for _, name := range cfg.ClaimsProviders {
+		provider, ok := services.BuiltinClaimsProviders[name]
+		if !ok {
+			logger.Error("Unknown claims provider: ", name)
+			log.Fatalf("Unknown claims provider: %s", name)
+		}
+		authService.RegisterClaimsProvider(provider)
+	}
+	accountService := services.NewAccountService(userRepo, passwordResetTokenRepo, sessionRepo, emailChangeTokenRepo, auditEventRepo, dataExportRepo, smtpMailer, cfg)
+	go purgeExpiredData(accountService, authService)
+	adminService := services.NewAdminService(userRepo, sessionRepo)
+	oauthService := services.NewOAuthService(authService, oauthClientRepo, authorizationCodeRepo, deviceCodeRepo, cfg)
 
 	authHandler := handlers.NewAuthHandler(authService)
 	confirmHandler := handlers.NewConfirmHandler(authService)
 	passwordResetHandler := handlers.NewPasswordResetHandler(authService)
+	jwksHandler := handlers.NewJWKSHandler(keys)
+	oidcHandler := handlers.NewOIDCHandler(authService, keys, cfg)
+	oauthHandler := handlers.NewOAuthHandler(oauthService)
+	profileHandler := handlers.NewProfileHandler(accountService)
+	adminHandler := handlers.NewAdminHandler(adminService)
+	authMiddleware := handlers.NewAuthMiddleware(authService, cfg.JWTAudience)
 
-	routes.RegisterRoutes(authHandler, confirmHandler, passwordResetHandler)
+	routes.RegisterRoutes(authHandler, confirmHandler, passwordResetHandler, jwksHandler, oidcHandler, oauthHandler, profileHandler, adminHandler, authMiddleware)
 
 	logger.Info("Server starting on port ", cfg.ServerPort)
 	if err := http.ListenAndServe(":"+cfg.ServerPort, nil); err != nil {
@@ -48,3 +95,32 @@ func Run() {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
+
+const accountPurgeInterval = time.Hour
+
+// purgeExpiredData deletes accounts whose deletion grace period is over, data
+// exports whose download link has expired, and expired sessions and tokens.
+func purgeExpiredData(accountService services.AccountService, authService services.AuthService) {
+	ticker := time.NewTicker(accountPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := accountService.PurgeDeletedAccounts()
+		if err != nil {
+			logger.Error("Error purging deleted accounts: ", err)
+		} else if n > 0 {
+			logger.Info("Purged ", n, " deleted accounts")
+		}
+
+		if _, err := accountService.PurgeExpiredExports(); err != nil {
+			logger.Error("Error purging expired data exports: ", err)
+		}
+
+		if n, err := authService.PurgeExpiredTokens(); err != nil {
+			logger.Error("Error purging expired sessions and tokens: ", err)
+		} else if n > 0 {
+			logger.Info("Purged ", n, " expired sessions and tokens")
+		}
+		<-ticker.C
+	}
+}
@@ -1,11 +1,15 @@
 package config
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
 )
 
+const defaultBaseURL = "http://localhost:8080"
+
 type DatabaseConfig struct {
 	Host     string
 	Port     int
@@ -15,15 +19,41 @@ type DatabaseConfig struct {
 }
 
 type Config struct {
-	ServerPort    string
-	Database      DatabaseConfig
-	SMTPHost      string
-	SMTPPort      int
-	SMTPUsername  string
-	SMTPPassword  string
-	JWTSecret     string
-	JWTExpiry     time.Duration
-	RefreshExpiry time.Duration
+	ServerPort     string
+	BaseURL        string
+	OIDCClientID   string
+	Database       DatabaseConfig
+	SMTPHost       string
+	SMTPPort       int
+	SMTPUsername   string
+	SMTPPassword   string
+	JWTSecret      string
+	JWTKeysDir     string
+	JWTActiveKeyID string
+	Issuer         string
+	JWTAudience    []string
+	JWTExpiry      time.Duration
+	RefreshExpiry  time.Duration
+	ClientExpiry   time.Duration
+	ExchangeExpiry time.Duration
+	TokenFormat    string
+	OpaqueTokens   bool
+	DPoPNonce      bool
+
+	KeyEncryptionKey  string
+	KeyReloadInterval time.Duration
+
+	ClaimsProviders    []string
+	MaxExtraClaimsSize int
+
+	AccountDeletionGrace time.Duration
+
+	ExportSyncMaxRecords int
+	ExportLinkSecret     string
+	ExportLinkExpiry     time.Duration
+
+	ClientAudiences      map[string][]string
+	IntrospectionClients map[string]string
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -37,14 +67,26 @@ func LoadConfig(path string) (*Config, error) {
 	viper.SetDefault("DB_NAME", "authforge")
 
 	viper.SetDefault("SERVER_PORT", "8080")
+	viper.SetDefault("BASE_URL", defaultBaseURL)
+	viper.SetDefault("OIDC_CLIENT_ID", "authforge")
 	viper.SetDefault("JWT_EXPIRY", "24h")
 	viper.SetDefault("REFRESH_EXPIRY", "168h")
+	viper.SetDefault("CLIENT_TOKEN_EXPIRY", "1h")
+	viper.SetDefault("KEY_RELOAD_INTERVAL", "1m")
+	viper.SetDefault("TOKEN_FORMAT", "jwt")
+	viper.SetDefault("TOKEN_EXCHANGE_EXPIRY", "5m")
+	viper.SetDefault("MAX_EXTRA_CLAIMS_SIZE", 2048)
+	viper.SetDefault("ACCOUNT_DELETION_GRACE", "720h")
+	viper.SetDefault("EXPORT_SYNC_MAX_RECORDS", 1000)
+	viper.SetDefault("EXPORT_LINK_EXPIRY", "24h")
 
 	if err := viper.ReadInConfig(); err != nil {
 	}
 
 	cfg := &Config{
-		ServerPort: viper.GetString("SERVER_PORT"),
+		ServerPort:   viper.GetString("SERVER_PORT"),
+		BaseURL:      strings.TrimSuffix(viper.GetString("BASE_URL"), "/"),
+		OIDCClientID: viper.GetString("OIDC_CLIENT_ID"),
 		Database: DatabaseConfig{
 			Host:     viper.GetString("DB_HOST"),
 			Port:     viper.GetInt("DB_PORT"),
@@ -52,13 +94,83 @@ func LoadConfig(path string) (*Config, error) {
 			Password: viper.GetString("DB_PASSWORD"),
 			DBName:   viper.GetString("DB_NAME"),
 		},
-		SMTPHost:      viper.GetString("SMTP_HOST"),
-		SMTPPort:      viper.GetInt("SMTP_PORT"),
-		SMTPUsername:  viper.GetString("SMTP_USERNAME"),
-		SMTPPassword:  viper.GetString("SMTP_PASSWORD"),
-		JWTSecret:     viper.GetString("JWT_SECRET"),
-		JWTExpiry:     viper.GetDuration("JWT_EXPIRY"),
-		RefreshExpiry: viper.GetDuration("REFRESH_EXPIRY"),
+		SMTPHost:       viper.GetString("SMTP_HOST"),
+		SMTPPort:       viper.GetInt("SMTP_PORT"),
+		SMTPUsername:   viper.GetString("SMTP_USERNAME"),
+		SMTPPassword:   viper.GetString("SMTP_PASSWORD"),
+		JWTSecret:      viper.GetString("JWT_SECRET"),
+		JWTKeysDir:     viper.GetString("JWT_KEYS_DIR"),
+		JWTActiveKeyID: viper.GetString("JWT_ACTIVE_KEY_ID"),
+		Issuer:         strings.TrimSuffix(viper.GetString("JWT_ISSUER"), "/"),
+		JWTAudience:    parseList(viper.GetString("JWT_AUDIENCE"), ","),
+		JWTExpiry:      viper.GetDuration("JWT_EXPIRY"),
+		RefreshExpiry:  viper.GetDuration("REFRESH_EXPIRY"),
+		ClientExpiry:   viper.GetDuration("CLIENT_TOKEN_EXPIRY"),
+		ExchangeExpiry: viper.GetDuration("TOKEN_EXCHANGE_EXPIRY"),
+		TokenFormat:    viper.GetString("TOKEN_FORMAT"),
+		OpaqueTokens:   viper.GetBool("OPAQUE_TOKENS"),
+		DPoPNonce:      viper.GetBool("DPOP_REQUIRE_NONCE"),
+
+		KeyEncryptionKey:  viper.GetString("KEY_ENCRYPTION_KEY"),
+		KeyReloadInterval: viper.GetDuration("KEY_RELOAD_INTERVAL"),
+
+		ClaimsProviders:    parseList(viper.GetString("TOKEN_CLAIMS_PROVIDERS"), ","),
+		MaxExtraClaimsSize: viper.GetInt("MAX_EXTRA_CLAIMS_SIZE"),
+
+		AccountDeletionGrace: viper.GetDuration("ACCOUNT_DELETION_GRACE"),
+
+		ExportSyncMaxRecords: viper.GetInt("EXPORT_SYNC_MAX_RECORDS"),
+		ExportLinkSecret:     viper.GetString("EXPORT_LINK_SECRET"),
+		ExportLinkExpiry:     viper.GetDuration("EXPORT_LINK_EXPIRY"),
+
+		ClientAudiences:      parseClientAudiences(viper.GetString("JWT_CLIENT_AUDIENCES")),
+		IntrospectionClients: parseCredentials(viper.GetString("INTROSPECTION_CLIENTS")),
+	}
+	// Deriving the issuer from BASE_URL would let environments that share
+	// a URL or the default accept each other's tokens.
+	if cfg.Issuer == "" {
+		return nil, errors.New("JWT_ISSUER must be set")
+	}
+	// Export links signed with a per-process secret would break on restart
+	// and across replicas.
+	if cfg.ExportSyncMaxRecords >= 0 && cfg.ExportLinkSecret == "" {
+		return nil, errors.New("EXPORT_LINK_SECRET must be set unless EXPORT_SYNC_MAX_RECORDS is negative")
 	}
 	return cfg, nil
 }
+
+func parseList(raw, sep string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseClientAudiences reads "client=aud1|aud2" entries separated by commas.
+func parseClientAudiences(raw string) map[string][]string {
+	audiences := make(map[string][]string)
+	for _, entry := range parseList(raw, ",") {
+		clientID, auds, ok := strings.Cut(entry, "=")
+		if !ok || clientID == "" {
+			continue
+		}
+		audiences[clientID] = parseList(auds, "|")
+	}
+	return audiences
+}
+
+// parseCredentials reads "id:secret" pairs separated by commas.
+func parseCredentials(raw string) map[string]string {
+	creds := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || id == "" || secret == "" {
+			continue
+		}
+		creds[id] = secret
+	}
+	return creds
+}
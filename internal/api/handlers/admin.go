@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"authforge/internal/logger"
+	"authforge/internal/models"
+	"authforge/internal/services"
+)
+
+type AdminHandler struct {
+	AdminService services.AdminService
+}
+
+func NewAdminHandler(adminService services.AdminService) *AdminHandler {
+	return &AdminHandler{
+		AdminService: adminService,
+	}
+}
+
+func (h *AdminHandler) Users(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Admin user list request received")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter, err := parseUserFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, _ := strconv.Atoi(query.Get("page"))
+	pageSize, _ := strconv.Atoi(query.Get("pageSize"))
+
+	users, err := h.AdminService.ListUsers(filter, page, pageSize)
+	if err != nil {
+		http.Error(w, "Could not list users", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(users)
+}
+
+// parseUserFilter reads the role, active, createdAfter, createdBefore and
+// email query parameters. Dates are RFC 3339 timestamps or plain dates.
+func parseUserFilter(query url.Values) (*models.UserFilter, error) {
+	filter := &models.UserFilter{Email: query.Get("email")}
+
+	if role := query.Get("role"); role != "" {
+		r := models.UserRole(role)
+		if r != models.RoleUser && r != models.RoleAdmin {
+			return nil, errors.New("invalid role")
+		}
+		filter.Role = &r
+	}
+
+	if active := query.Get("active"); active != "" {
+		isActive, err := strconv.ParseBool(active)
+		if err != nil {
+			return nil, errors.New("invalid active")
+		}
+		filter.IsActive = &isActive
+	}
+
+	for name, dst := range map[string]**time.Time{
+		"createdAfter":  &filter.CreatedAfter,
+		"createdBefore": &filter.CreatedBefore,
+	} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", value); err != nil {
+				return nil, errors.New("invalid " + name)
+			}
+		}
+		*dst = &t
+	}
+	return filter, nil
+}
+
+func (h *AdminHandler) User(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.getUser(w, id)
+	case http.MethodPatch:
+		h.updateUser(w, r, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *AdminHandler) getUser(w http.ResponseWriter, id uuid.UUID) {
+	logger.Info("Admin user request received for ", id)
+	user, err := h.AdminService.GetUser(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *AdminHandler) updateUser(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	logger.Info("Admin user update request received for ", id)
+	adminID, err := currentUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var req services.AdminUserUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Invalid request payload: ", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.AdminService.UpdateUser(adminID, id, &req)
+	if err != nil {
+		logger.Error("Admin update of user ", id, " failed: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *AdminHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	logger.Info("Admin logout request received for ", id)
+
+	if err := h.AdminService.ForceLogout(id); err != nil {
+		logger.Error("Admin logout of user ", id, " failed: ", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	resp := ResponseMessage{Message: "User logged out from all devices."}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"authforge/internal/dpop"
 	"authforge/internal/logger"
 	"authforge/internal/models"
 	"authforge/internal/services"
@@ -22,7 +24,6 @@ func NewAuthHandler(authService services.AuthService) *AuthHandler {
 type RegisterRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
-	Role     string `json:"role"`
 }
 
 type ResponseMessage struct {
@@ -45,7 +46,6 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	user := &models.User{
 		Email: req.Email,
-		Role:  models.UserRole(req.Role),
 	}
 
 	if err := h.AuthService.RegisterUser(user, req.Password); err != nil {
@@ -63,11 +63,14 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	ClientID string `json:"clientId"`
 }
 
 type LoginResponse struct {
 	AccessToken  string `json:"accessToken"`
 	RefreshToken string `json:"refreshToken"`
+	IDToken      string `json:"idToken,omitempty"`
+	TokenType    string `json:"tokenType"`
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -84,9 +87,10 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokens, err := h.AuthService.Login(req.Email, req.Password)
+	tokens, err := h.AuthService.Login(req.Email, req.Password, req.ClientID, requestProof(r))
 	if err != nil {
 		logger.Error("Login failed for ", req.Email, ": ", err)
+		h.writeDPoPNonce(w, r, err)
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
@@ -94,9 +98,102 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	resp := LoginResponse{
 		AccessToken:  tokens.AccessToken,
 		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		TokenType:    tokens.TokenType,
 	}
 
 	logger.Info("User logged in successfully: ", req.Email)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Token refresh request received")
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Invalid request payload: ", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.RefreshToken == "" {
+		logger.Error("Refresh token is required")
+		http.Error(w, "Refresh token required", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.AuthService.Refresh(req.RefreshToken, nil, requestProof(r))
+	if err != nil {
+		logger.Error("Token refresh failed: ", err)
+		h.writeDPoPNonce(w, r, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	resp := LoginResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		TokenType:    tokens.TokenType,
+	}
+
+	logger.Info("Tokens refreshed successfully")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Logout request received")
+
+	tokenStr, proof, err := accessToken(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.AuthService.Logout(tokenStr, proof); err != nil {
+		logger.Error("Logout failed: ", err)
+		writeTokenError(w, h.AuthService, proof, err)
+		return
+	}
+
+	logger.Info("User logged out successfully")
+	resp := ResponseMessage{Message: "Logged out successfully."}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Logout from all devices request received")
+	tokenStr, proof, err := accessToken(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.AuthService.LogoutAll(tokenStr, proof); err != nil {
+		logger.Error("Logout from all devices failed: ", err)
+		writeTokenError(w, h.AuthService, proof, err)
+		return
+	}
+
+	logger.Info("User logged out from all devices")
+	resp := ResponseMessage{Message: "Logged out from all devices."}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeDPoPNonce hands DPoP clients a nonce to retry with after a rejected
+// token request.
+func (h *AuthHandler) writeDPoPNonce(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Header.Get("DPoP") == "" {
+		return
+	}
+	w.Header().Set("DPoP-Nonce", h.AuthService.DPoPNonce())
+	if errors.Is(err, dpop.ErrUseNonce) {
+		w.Header().Set("WWW-Authenticate", `DPoP error="use_dpop_nonce"`)
+	}
+}
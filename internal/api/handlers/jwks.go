@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"authforge/internal/keyring"
+	"authforge/internal/logger"
+)
+
+type JWKSHandler struct {
+	Keys *keyring.Keyring
+}
+
+func NewJWKSHandler(keys *keyring.Keyring) *JWKSHandler {
+	return &JWKSHandler{
+		Keys: keys,
+	}
+}
+
+func (h *JWKSHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("JWKS request received")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=900, must-revalidate")
+	json.NewEncoder(w).Encode(h.Keys.JWKS())
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"authforge/internal/logger"
+	"authforge/internal/models"
+	"authforge/internal/services"
+)
+
+type claimsContextKey struct{}
+
+type AuthMiddleware struct {
+	AuthService services.AuthService
+	Audience    []string
+}
+
+func NewAuthMiddleware(authService services.AuthService, audience []string) *AuthMiddleware {
+	return &AuthMiddleware{
+		AuthService: authService,
+		Audience:    audience,
+	}
+}
+
+// RequireAuth rejects requests without a valid access token and passes the
+// token claims on to next through the request context. Delegated tokens and
+// tokens issued for other APIs are refused.
+func (m *AuthMiddleware) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenStr, proof, err := accessToken(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := m.AuthService.ValidateDPoPToken(tokenStr, proof)
+		if err != nil {
+			logger.Error("Unauthenticated request to ", r.URL.Path, ": ", err)
+			writeTokenError(w, m.AuthService, proof, err)
+			return
+		}
+
+		if claims.Act != nil {
+			logger.Error("Delegated token used at ", r.URL.Path, " by ", claims.Act.Subject)
+			writeTokenError(w, m.AuthService, proof, errors.New("delegated token"))
+			return
+		}
+		if !m.issuedForAPI(claims) {
+			logger.Error("Token for another audience used at ", r.URL.Path, " by ", claims.Subject)
+			writeTokenError(w, m.AuthService, proof, errors.New("invalid audience"))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), claimsContextKey{}, claims)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// issuedForAPI reports whether the token is meant for this API: it must name
+// one of JWT_AUDIENCE or, when that is unset, carry no audience at all.
+func (m *AuthMiddleware) issuedForAPI(claims *models.CustomClaims) bool {
+	if len(m.Audience) == 0 {
+		return len(claims.Audience) == 0
+	}
+	for _, aud := range m.Audience {
+		if claims.VerifyAudience(aud, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRole works like RequireAuth but also rejects tokens issued for a
+// different role.
+func (m *AuthMiddleware) RequireRole(role models.UserRole, next http.HandlerFunc) http.HandlerFunc {
+	return m.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := ClaimsFromContext(r.Context())
+		if claims.Role != string(role) {
+			logger.Error("Forbidden request to ", r.URL.Path, " by ", claims.Subject)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
+func ClaimsFromContext(ctx context.Context) (*models.CustomClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*models.CustomClaims)
+	return claims, ok
+}
@@ -0,0 +1,436 @@
+package handlers
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"authforge/internal/logger"
+	"authforge/internal/services"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var pageTemplates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+type OAuthHandler struct {
+	OAuthService services.OAuthService
+}
+
+func NewOAuthHandler(oauthService services.OAuthService) *OAuthHandler {
+	return &OAuthHandler{
+		OAuthService: oauthService,
+	}
+}
+
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="authforge"`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(OAuthErrorResponse{Error: code, ErrorDescription: description})
+}
+
+func writeServiceOAuthError(w http.ResponseWriter, err error) {
+	var oauthErr *services.OAuthError
+	if !errors.As(err, &oauthErr) {
+		logger.Error("OAuth request failed: ", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == "invalid_client" {
+		status = http.StatusUnauthorized
+	}
+	writeOAuthError(w, status, oauthErr.Code, oauthErr.Description)
+}
+
+// authenticateClient accepts client credentials either through HTTP Basic
+// auth or the client_id/client_secret form parameters.
+func (h *OAuthHandler) authenticateClient(r *http.Request) (string, error) {
+	clientID, clientSecret := clientCredentials(r)
+	if err := h.OAuthService.AuthenticateClient(clientID, clientSecret); err != nil {
+		return "", err
+	}
+	return clientID, nil
+}
+
+func clientCredentials(r *http.Request) (string, string) {
+	if clientID, clientSecret, ok := r.BasicAuth(); ok {
+		return clientID, clientSecret
+	}
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+}
+
+func (h *OAuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Token introspection request received")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	clientID, err := h.authenticateClient(r)
+	if err != nil {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	result, err := h.OAuthService.Introspect(token, r.PostForm.Get("token_type_hint"))
+	if err != nil {
+		logger.Error("Token introspection failed: ", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	logger.Info("Token introspected by client ", clientID, ", active: ", result.Active)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (h *OAuthHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Token revocation request received")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	// Public clients may revoke their own tokens too, so they are identified
+	// by client_id alone like at the token endpoint.
+	client, err := h.OAuthService.ResolveClient(clientCredentials(r))
+	if err != nil {
+		writeServiceOAuthError(w, err)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	if err := h.OAuthService.Revoke(client, token, r.PostForm.Get("token_type_hint")); err != nil {
+		logger.Error("Token revocation failed: ", err)
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return
+	}
+
+	logger.Info("Token revocation processed for client ", client.ID)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+type ConsentPage struct {
+	Action     string
+	ClientName string
+	Scopes     []string
+	Params     map[string]string
+	Email      string
+	Error      string
+}
+
+func (h *OAuthHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Authorization request received")
+	var params url.Values
+	switch r.Method {
+	case http.MethodGet:
+		params = r.URL.Query()
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		params = r.PostForm
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := h.OAuthService.ParseAuthorizationRequest(params)
+	if req == nil {
+		logger.Error("Rejected authorization request: ", err)
+		http.Error(w, "Invalid authorization request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		redirectWithError(w, r, req, err)
+		return
+	}
+
+	page := &ConsentPage{
+		Action:     "/oauth/authorize",
+		ClientName: req.Client.Name,
+		Scopes:     strings.Fields(req.Scope),
+		Params: map[string]string{
+			"response_type":         "code",
+			"client_id":             req.Client.ID,
+			"redirect_uri":          req.RedirectURI,
+			"scope":                 req.Scope,
+			"state":                 req.State,
+			"code_challenge":        req.CodeChallenge,
+			"code_challenge_method": req.CodeChallengeMethod,
+			"nonce":                 req.Nonce,
+		},
+	}
+
+	if r.Method == http.MethodGet {
+		renderPage(w, "authorize.html", page)
+		return
+	}
+
+	if params.Get("action") != "approve" {
+		logger.Info("User denied authorization for client ", req.Client.ID)
+		redirectWithError(w, r, req, &services.OAuthError{Code: "access_denied", Description: "the user denied the request"})
+		return
+	}
+
+	code, err := h.OAuthService.Authorize(req, params.Get("email"), params.Get("password"))
+	if err != nil {
+		var oauthErr *services.OAuthError
+		if errors.As(err, &oauthErr) {
+			redirectWithError(w, r, req, err)
+			return
+		}
+		logger.Error("Authorization failed for client ", req.Client.ID, ": ", err)
+		page.Email = params.Get("email")
+		page.Error = err.Error()
+		w.WriteHeader(http.StatusUnauthorized)
+		renderPage(w, "authorize.html", page)
+		return
+	}
+
+	redirectWithParams(w, r, req.RedirectURI, url.Values{"code": {code}, "state": {req.State}})
+}
+
+func renderPage(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	if err := pageTemplates.ExecuteTemplate(w, name, data); err != nil {
+		logger.Error("Error rendering ", name, ": ", err)
+	}
+}
+
+func redirectWithError(w http.ResponseWriter, r *http.Request, req *services.AuthorizationRequest, err error) {
+	code, description := "server_error", ""
+	var oauthErr *services.OAuthError
+	if errors.As(err, &oauthErr) {
+		code, description = oauthErr.Code, oauthErr.Description
+	}
+	redirectWithParams(w, r, req.RedirectURI, url.Values{
+		"error":             {code},
+		"error_description": {description},
+		"state":             {req.State},
+	})
+}
+
+func redirectWithParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	query := target.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+func (h *OAuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Token request received")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	clientID, clientSecret := clientCredentials(r)
+	if clientID == "" {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "client_id is required")
+		return
+	}
+
+	client, err := h.OAuthService.ResolveClient(clientID, clientSecret)
+	if err != nil {
+		writeServiceOAuthError(w, err)
+		return
+	}
+
+	var tokens *services.TokenPair
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case "authorization_code":
+		tokens, err = h.OAuthService.ExchangeAuthorizationCode(
+			client.ID,
+			r.PostForm.Get("code"),
+			r.PostForm.Get("redirect_uri"),
+			r.PostForm.Get("code_verifier"),
+		)
+	case "refresh_token":
+		tokens, err = h.OAuthService.RefreshToken(client, r.PostForm.Get("refresh_token"))
+	case "client_credentials":
+		tokens, err = h.OAuthService.ClientCredentials(client, r.PostForm.Get("scope"))
+	case "urn:ietf:params:oauth:grant-type:device_code":
+		tokens, err = h.OAuthService.PollDeviceToken(client, r.PostForm.Get("device_code"))
+	case "urn:ietf:params:oauth:grant-type:token-exchange":
+		tokens, err = h.OAuthService.ExchangeToken(client, &services.TokenExchangeRequest{
+			SubjectToken:       r.PostForm.Get("subject_token"),
+			SubjectTokenType:   r.PostForm.Get("subject_token_type"),
+			RequestedTokenType: r.PostForm.Get("requested_token_type"),
+			Scope:              r.PostForm.Get("scope"),
+			Audience:           r.PostForm["audience"],
+		})
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type "+grantType+" is not supported")
+		return
+	}
+	if err != nil {
+		logger.Error("Token request failed for client ", clientID, ": ", err)
+		writeServiceOAuthError(w, err)
+		return
+	}
+
+	writeTokenResponse(w, tokens)
+}
+
+func writeTokenResponse(w http.ResponseWriter, tokens *services.TokenPair) {
+	resp := TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    tokens.ExpiresIn,
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		Scope:        tokens.Scope,
+
+		IssuedTokenType: tokens.IssuedTokenType,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *OAuthHandler) DeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Device authorization request received")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	clientID, clientSecret := clientCredentials(r)
+	client, err := h.OAuthService.ResolveClient(clientID, clientSecret)
+	if err != nil {
+		writeServiceOAuthError(w, err)
+		return
+	}
+
+	authorization, err := h.OAuthService.StartDeviceAuthorization(client, r.PostForm.Get("scope"))
+	if err != nil {
+		writeServiceOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(authorization)
+}
+
+type DevicePage struct {
+	ClientName string
+	Scopes     []string
+	UserCode   string
+	Email      string
+	Error      string
+	Done       bool
+	Message    string
+}
+
+func (h *OAuthHandler) Device(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Device verification request received")
+	switch r.Method {
+	case http.MethodGet:
+		page := &DevicePage{UserCode: r.URL.Query().Get("user_code")}
+		if page.UserCode != "" {
+			if dc, client, err := h.OAuthService.GetDeviceAuthorization(page.UserCode); err == nil {
+				page.ClientName = client.Name
+				page.Scopes = strings.Fields(dc.Scope)
+			}
+		}
+		renderPage(w, "device.html", page)
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		page := &DevicePage{UserCode: r.PostForm.Get("user_code"), Email: r.PostForm.Get("email")}
+		approved := r.PostForm.Get("action") == "approve"
+		client, err := h.OAuthService.CompleteDeviceAuthorization(page.UserCode, page.Email, r.PostForm.Get("password"), approved)
+		if err != nil {
+			logger.Error("Device verification failed: ", err)
+			page.Error = err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+			renderPage(w, "device.html", page)
+			return
+		}
+
+		page.Done = true
+		page.Message = "Access denied to " + client.Name + "."
+		if approved {
+			page.Message = client.Name + " is now connected."
+		}
+		renderPage(w, "device.html", page)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"authforge/config"
+	"authforge/internal/keyring"
+	"authforge/internal/logger"
+	"authforge/internal/services"
+)
+
+type OIDCHandler struct {
+	AuthService services.AuthService
+	Keys        *keyring.Keyring
+	Config      *config.Config
+}
+
+func NewOIDCHandler(authService services.AuthService, keys *keyring.Keyring, cfg *config.Config) *OIDCHandler {
+	return &OIDCHandler{
+		AuthService: authService,
+		Keys:        keys,
+		Config:      cfg,
+	}
+}
+
+type DiscoveryDocument struct {
+	Issuer                           string   `json:"issuer"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint      string   `json:"device_authorization_endpoint"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	UserinfoEndpoint                 string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint            string   `json:"introspection_endpoint"`
+	RevocationEndpoint               string   `json:"revocation_endpoint"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	GrantTypesSupported              []string `json:"grant_types_supported"`
+	CodeChallengeMethodsSupported    []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethods         []string `json:"token_endpoint_auth_methods_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                  []string `json:"scopes_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+	DPoPSigningAlgValuesSupported    []string `json:"dpop_signing_alg_values_supported"`
+}
+
+func (h *OIDCHandler) Discovery(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("OpenID configuration request received")
+	// HMAC keys are never published, so ID tokens are only signed and
+	// advertised with asymmetric keys.
+	algs := []string{}
+	seen := map[string]bool{}
+	for _, key := range h.Keys.Keys() {
+		if !key.IsSymmetric() && !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			algs = append(algs, key.Algorithm)
+		}
+	}
+
+	doc := DiscoveryDocument{
+		Issuer:                           h.Config.Issuer,
+		AuthorizationEndpoint:            h.Config.BaseURL + "/oauth/authorize",
+		TokenEndpoint:                    h.Config.BaseURL + "/oauth/token",
+		DeviceAuthorizationEndpoint:      h.Config.BaseURL + "/oauth/device_authorization",
+		JWKSURI:                          h.Config.BaseURL + "/.well-known/jwks.json",
+		UserinfoEndpoint:                 h.Config.BaseURL + "/userinfo",
+		IntrospectionEndpoint:            h.Config.BaseURL + "/oauth/introspect",
+		RevocationEndpoint:               h.Config.BaseURL + "/oauth/revoke",
+		ResponseTypesSupported:           []string{"code"},
+		GrantTypesSupported:              []string{"authorization_code", "refresh_token", "client_credentials", "urn:ietf:params:oauth:grant-type:device_code", "urn:ietf:params:oauth:grant-type:token-exchange"},
+		CodeChallengeMethodsSupported:    []string{"S256"},
+		TokenEndpointAuthMethods:         []string{"none", "client_secret_basic", "client_secret_post"},
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: algs,
+		ScopesSupported:                  []string{"email"},
+		ClaimsSupported:                  []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "email", "email_verified"},
+		DPoPSigningAlgValuesSupported:    []string{"RS256", "ES256", "ES384", "ES512", "EdDSA"},
+	}
+
+	if !h.Keys.SigningKey().IsSymmetric() {
+		doc.ScopesSupported = []string{"openid", "email"}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=900, must-revalidate")
+	json.NewEncoder(w).Encode(doc)
+}
+
+type UserInfoResponse struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+func (h *OIDCHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Userinfo request received")
+	tokenStr, proof, err := accessToken(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := h.AuthService.ValidateDPoPToken(tokenStr, proof)
+	if err != nil {
+		writeTokenError(w, h.AuthService, proof, err)
+		return
+	}
+
+	// OIDC Core 5.3: userinfo needs an access token of an OpenID sign-in, the
+	// same ones that come with an ID token. Client credentials and delegated
+	// tokens are never one.
+	if claims.UserID == "" || claims.Act != nil || !services.GrantsOpenID(claims.Scope) {
+		logger.Error("Userinfo rejected for ", claims.Subject, ": openid scope missing")
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		http.Error(w, "insufficient scope", http.StatusForbidden)
+		return
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.AuthService.GetUserByID(userID)
+	if err != nil {
+		logger.Error("Userinfo lookup failed for ", userID, ": ", err)
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	resp := UserInfoResponse{
+		Subject:       user.ID.String(),
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"authforge/internal/logger"
+	"authforge/internal/services"
+)
+
+type ProfileHandler struct {
+	AccountService services.AccountService
+}
+
+func NewProfileHandler(accountService services.AccountService) *ProfileHandler {
+	return &ProfileHandler{
+		AccountService: accountService,
+	}
+}
+
+func (h *ProfileHandler) Me(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getProfile(w, r)
+	case http.MethodPatch:
+		h.updateProfile(w, r)
+	case http.MethodDelete:
+		h.deleteAccount(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *ProfileHandler) getProfile(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Profile request received")
+	userID, err := currentUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	user, err := h.AccountService.GetProfile(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *ProfileHandler) updateProfile(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Profile update request received")
+	userID, err := currentUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var req services.ProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Invalid request payload: ", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.AccountService.UpdateProfile(userID, &req)
+	if err != nil {
+		logger.Error("Profile update failed for user ", userID, ": ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(user)
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+type DeleteAccountResponse struct {
+	Message             string    `json:"message"`
+	DeletionScheduledAt time.Time `json:"deletionScheduledAt"`
+}
+
+func (h *ProfileHandler) deleteAccount(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Account deletion request received")
+	userID, err := currentUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Invalid request payload: ", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.Password == "" {
+		http.Error(w, "Password required", http.StatusBadRequest)
+		return
+	}
+
+	deleteAt, err := h.AccountService.DeleteAccount(userID, req.Password)
+	if err != nil {
+		logger.Error("Account deletion failed for user ", userID, ": ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := DeleteAccountResponse{
+		Message:             "Account scheduled for deletion. Sign in before then to keep it.",
+		DeletionScheduledAt: deleteAt,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// currentUserID returns the user behind the authenticated request. Tokens
+// issued to clients rather than users have none.
+func currentUserID(r *http.Request) (uuid.UUID, error) {
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok {
+		return uuid.Nil, errors.New("not authenticated")
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return uuid.Nil, errors.New("token does not belong to a user")
+	}
+	return userID, nil
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword      string `json:"currentPassword"`
+	NewPassword          string `json:"newPassword"`
+	SignOutOtherSessions bool   `json:"signOutOtherSessions"`
+}
+
+func (h *ProfileHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Password change request received")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := currentUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Invalid request payload: ", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		http.Error(w, "Current and new password required", http.StatusBadRequest)
+		return
+	}
+
+	claims, _ := ClaimsFromContext(r.Context())
+	sessionID, _ := uuid.Parse(claims.SessionID)
+
+	if err := h.AccountService.ChangePassword(userID, sessionID, req.CurrentPassword, req.NewPassword, req.SignOutOtherSessions); err != nil {
+		logger.Error("Password change failed for user ", userID, ": ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := ResponseMessage{Message: "Password changed successfully."}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"newEmail"`
+	Password string `json:"password"`
+}
+
+func (h *ProfileHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Email change request received")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := currentUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var req ChangeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Invalid request payload: ", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.NewEmail == "" || req.Password == "" {
+		http.Error(w, "New email and password required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.AccountService.RequestEmailChange(userID, req.NewEmail, req.Password); err != nil {
+		logger.Error("Email change failed for user ", userID, ": ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := ResponseMessage{Message: "A confirmation link has been sent to the new email address."}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resp)
+}
+
+type EmailChangePage struct {
+	Title   string
+	Prompt  string
+	Action  string
+	Button  string
+	Token   string
+	Error   string
+	Done    bool
+	Message string
+}
+
+// ConfirmEmailChange shows a confirmation step for the link mailed to the
+// new address on GET and only swaps the address on POST, so link scanners
+// following the link change nothing.
+func (h *ProfileHandler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Email change confirmation received")
+	page := &EmailChangePage{
+		Title:  "Confirm your new email address",
+		Prompt: "Confirm that this address should become the email address of your account.",
+		Action: "/api/v1/me/email/confirm",
+		Button: "Confirm",
+	}
+	emailChangeStep(w, r, page, h.AccountService.ConfirmEmailChange, "Email address changed successfully.")
+}
+
+// RevertEmailChange works like ConfirmEmailChange for the undo link mailed
+// to the old address.
+func (h *ProfileHandler) RevertEmailChange(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Email change revert received")
+	page := &EmailChangePage{
+		Title:  "Restore your email address",
+		Prompt: "Restoring your previous email address also signs you out on all devices.",
+		Action: "/api/v1/me/email/revert",
+		Button: "Restore and sign out everywhere",
+	}
+	emailChangeStep(w, r, page, h.AccountService.RevertEmailChange, "Email address restored. All sessions have been signed out; please reset your password.")
+}
+
+func emailChangeStep(w http.ResponseWriter, r *http.Request, page *EmailChangePage, apply func(token string) error, done string) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		page.Token = r.URL.Query().Get("token")
+		if page.Token == "" {
+			http.Error(w, "token is required", http.StatusBadRequest)
+			return
+		}
+		renderPage(w, "email_change.html", page)
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		page.Token = r.PostForm.Get("token")
+		if page.Token == "" {
+			http.Error(w, "token is required", http.StatusBadRequest)
+			return
+		}
+
+		if err := apply(page.Token); err != nil {
+			logger.Error("Email change step failed: ", err)
+			page.Error = err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+			renderPage(w, "email_change.html", page)
+			return
+		}
+
+		page.Done = true
+		page.Message = done
+		renderPage(w, "email_change.html", page)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *ProfileHandler) Export(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Data export request received")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := currentUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	data, err := h.AccountService.ExportData(userID)
+	if err != nil {
+		logger.Error("Data export failed for user ", userID, ": ", err)
+		http.Error(w, "Could not export data", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if data == nil {
+		resp := ResponseMessage{Message: "Your export is being prepared. A download link will be sent to your email address."}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", exportDisposition(data.ExportedAt))
+	json.NewEncoder(w).Encode(data)
+}
+
+func (h *ProfileHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Data export download received")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	id, err := uuid.Parse(query.Get("id"))
+	if err != nil {
+		http.Error(w, "invalid or expired link", http.StatusBadRequest)
+		return
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid or expired link", http.StatusBadRequest)
+		return
+	}
+
+	export, err := h.AccountService.DownloadExport(id, expires, query.Get("sig"))
+	if err != nil {
+		logger.Error("Data export download failed: ", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Disposition", exportDisposition(*export.CompletedAt))
+	w.Write(export.Archive)
+}
+
+func exportDisposition(at time.Time) string {
+	return `attachment; filename="authforge-export-` + at.Format("2006-01-02") + `.json"`
+}
@@ -4,17 +4,48 @@ import (
 	"net/http"
 
 	"authforge/internal/api/handlers"
+	"authforge/internal/models"
 )
 
 func RegisterRoutes(
 	authHandler *handlers.AuthHandler,
 	confirmHandler *handlers.ConfirmHandler,
 	passwordResetHandler *handlers.PasswordResetHandler,
+	jwksHandler *handlers.JWKSHandler,
+	oidcHandler *handlers.OIDCHandler,
+	oauthHandler *handlers.OAuthHandler,
+	profileHandler *handlers.ProfileHandler,
+	adminHandler *handlers.AdminHandler,
+	authMiddleware *handlers.AuthMiddleware,
 ) {
 	http.HandleFunc("/api/v1/auth/register", authHandler.Register)
 	http.HandleFunc("/api/v1/auth/login", authHandler.Login)
+	http.HandleFunc("/api/v1/auth/refresh", authHandler.Refresh)
+	http.HandleFunc("/api/v1/auth/logout", authHandler.Logout)
+	http.HandleFunc("/api/v1/auth/logout-all", authHandler.LogoutAll)
 	http.HandleFunc("/api/v1/auth/confirm", confirmHandler.ConfirmAccount)
 	http.HandleFunc("/api/v1/auth/password-reset-request", passwordResetHandler.RequestPasswordReset)
 	http.HandleFunc("/api/v1/auth/password-reset-confirm", passwordResetHandler.ResetPassword)
 	http.HandleFunc("/api/v1/auth/validate", authHandler.ValidateToken)
+	http.HandleFunc("/api/v1/me", authMiddleware.RequireAuth(profileHandler.Me))
+	http.HandleFunc("/api/v1/me/password", authMiddleware.RequireAuth(profileHandler.ChangePassword))
+	http.HandleFunc("/api/v1/me/email", authMiddleware.RequireAuth(profileHandler.ChangeEmail))
+	http.HandleFunc("GET /api/v1/me/email/confirm", profileHandler.ConfirmEmailChange)
+	http.HandleFunc("POST /api/v1/me/email/confirm", profileHandler.ConfirmEmailChange)
+	http.HandleFunc("GET /api/v1/me/email/revert", profileHandler.RevertEmailChange)
+	http.HandleFunc("POST /api/v1/me/email/revert", profileHandler.RevertEmailChange)
+	http.HandleFunc("/api/v1/me/export", authMiddleware.RequireAuth(profileHandler.Export))
+	http.HandleFunc("/api/v1/me/export/download", profileHandler.DownloadExport)
+	http.HandleFunc("/api/v1/admin/users", authMiddleware.RequireRole(models.RoleAdmin, adminHandler.Users))
+	http.HandleFunc("/api/v1/admin/users/{id}", authMiddleware.RequireRole(models.RoleAdmin, adminHandler.User))
+	http.HandleFunc("/api/v1/admin/users/{id}/logout", authMiddleware.RequireRole(models.RoleAdmin, adminHandler.Logout))
+	http.HandleFunc("/.well-known/jwks.json", jwksHandler.GetJWKS)
+	http.HandleFunc("/.well-known/openid-configuration", oidcHandler.Discovery)
+	http.HandleFunc("/userinfo", oidcHandler.UserInfo)
+	http.HandleFunc("/oauth/authorize", oauthHandler.Authorize)
+	http.HandleFunc("/oauth/token", oauthHandler.Token)
+	http.HandleFunc("/oauth/device_authorization", oauthHandler.DeviceAuthorization)
+	http.HandleFunc("/oauth/device", oauthHandler.Device)
+	http.HandleFunc("/oauth/introspect", oauthHandler.Introspect)
+	http.HandleFunc("/oauth/revoke", oauthHandler.Revoke)
 }
@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"authforge/internal/dpop"
 	"authforge/internal/logger"
+	"authforge/internal/models"
 	"authforge/internal/services"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 )
@@ -14,22 +17,31 @@ type ValidateHandler struct {
 
 func (h *AuthHandler) ValidateToken(w http.ResponseWriter, r *http.Request) {
 	logger.Info("Token validation request received")
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		http.Error(w, "missing token", http.StatusUnauthorized)
+	tokenStr, proof, err := accessToken(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
-	const prefix = "Bearer "
-	if !strings.HasPrefix(authHeader, prefix) {
-		http.Error(w, "invalid token format", http.StatusUnauthorized)
-		return
+	// Resource servers forward the DPoP proof they received together with
+	// the method and URL of the request it was made for.
+	if proof != nil {
+		if htm := r.URL.Query().Get("htm"); htm != "" {
+			proof.Method = htm
+		}
+		if htu := r.URL.Query().Get("htu"); htu != "" {
+			proof.URL = htu
+		}
 	}
-	tokenStr := strings.TrimSpace(authHeader[len(prefix):])
 
-	claims, err := h.AuthService.ValidateToken(tokenStr)
+	var claims *models.CustomClaims
+	if audience := r.URL.Query().Get("audience"); audience != "" {
+		claims, err = h.AuthService.ValidateTokenForAudience(tokenStr, audience, proof)
+	} else {
+		claims, err = h.AuthService.ValidateDPoPToken(tokenStr, proof)
+	}
 	if err != nil {
-		http.Error(w, "invalid token", http.StatusUnauthorized)
+		writeTokenError(w, h.AuthService, proof, err)
 		return
 	}
 
@@ -38,6 +50,59 @@ func (h *AuthHandler) ValidateToken(w http.ResponseWriter, r *http.Request) {
 		"role":      claims.Role,
 		"expiresAt": claims.ExpiresAt.Time,
 	}
+	if len(claims.Extra) > 0 {
+		response["claims"] = claims.Extra
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// accessToken reads a Bearer or DPoP token from the Authorization header. For
+// the DPoP scheme it also returns the proof sent along with the request.
+func accessToken(r *http.Request) (string, *services.DPoPProof, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", nil, errors.New("missing token")
+	}
+
+	scheme, token, ok := strings.Cut(authHeader, " ")
+	if !ok {
+		return "", nil, errors.New("invalid token format")
+	}
+	token = strings.TrimSpace(token)
+
+	switch {
+	case strings.EqualFold(scheme, "Bearer"):
+		return token, nil, nil
+	case strings.EqualFold(scheme, "DPoP"):
+		return token, requestProof(r), nil
+	default:
+		return "", nil, errors.New("invalid token format")
+	}
+}
+
+func requestProof(r *http.Request) *services.DPoPProof {
+	return &services.DPoPProof{
+		Proof:  r.Header.Get("DPoP"),
+		Method: r.Method,
+		URL:    r.URL.Path,
+	}
+}
+
+// writeTokenError rejects a protected resource request, asking DPoP clients
+// for a fresh nonce when their proof lacked a valid one.
+func writeTokenError(w http.ResponseWriter, authService services.AuthService, proof *services.DPoPProof, err error) {
+	if proof == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("DPoP-Nonce", authService.DPoPNonce())
+	if errors.Is(err, dpop.ErrUseNonce) {
+		w.Header().Set("WWW-Authenticate", `DPoP error="use_dpop_nonce", error_description="Resource server requires nonce in DPoP proof"`)
+	} else {
+		w.Header().Set("WWW-Authenticate", `DPoP error="invalid_token"`)
+	}
+	http.Error(w, "invalid token", http.StatusUnauthorized)
+}
@@ -0,0 +1,184 @@
+package dpop
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"authforge/internal/keyring"
+)
+
+const (
+	proofMaxAge    = time.Minute
+	clockSkew      = 10 * time.Second
+	nonceLifetime  = 5 * time.Minute
+	proofTokenType = "dpop+jwt"
+)
+
+// ErrUseNonce asks the client to retry with the nonce from the DPoP-Nonce
+// response header.
+var ErrUseNonce = errors.New("use_dpop_nonce")
+
+type proofClaims struct {
+	HTM   string `json:"htm"`
+	HTU   string `json:"htu"`
+	Nonce string `json:"nonce,omitempty"`
+	ATH   string `json:"ath,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Verifier checks RFC 9449 DPoP proofs. Replayed proofs and nonces are
+// tracked in memory, so every instance behind a load balancer keeps its own.
+type Verifier struct {
+	requireNonce bool
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	nonce     string
+	prevNonce string
+	rotatedAt time.Time
+}
+
+func NewVerifier(requireNonce bool) *Verifier {
+	return &Verifier{requireNonce: requireNonce, seen: make(map[string]time.Time)}
+}
+
+// Nonce returns the nonce clients should put in their next proof.
+func (v *Verifier) Nonce() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.rotateNonce()
+	return v.nonce
+}
+
+// Verify checks a proof for a request with the given method and URL and
+// returns the thumbprint of the key that signed it. accessToken is empty when
+// the proof accompanies a token request rather than a protected resource.
+func (v *Verifier) Verify(proof, method, requestURL, accessToken string) (string, error) {
+	var jkt string
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	token, err := parser.ParseWithClaims(proof, &proofClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != proofTokenType {
+			return nil, errors.New("proof must have typ dpop+jwt")
+		}
+
+		raw, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("proof has no jwk header")
+		}
+		if _, ok := raw["d"]; ok {
+			return nil, errors.New("proof jwk must not contain a private key")
+		}
+
+		var jwk keyring.JWK
+		data, _ := json.Marshal(raw)
+		if err := json.Unmarshal(data, &jwk); err != nil {
+			return nil, err
+		}
+		key, err := keyring.ParsePublicJWK(jwk)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, errors.New("unexpected signing method")
+		}
+
+		jkt, err = keyring.Thumbprint(jwk)
+		if err != nil {
+			return nil, err
+		}
+		return key.PublicKey, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, ok := token.Claims.(*proofClaims)
+	if !ok || !token.Valid {
+		return "", errors.New("invalid proof")
+	}
+
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return "", errors.New("proof must have jti and iat")
+	}
+	now := time.Now()
+	if claims.IssuedAt.Time.After(now.Add(clockSkew)) || claims.IssuedAt.Time.Before(now.Add(-proofMaxAge)) {
+		return "", errors.New("proof is too old or from the future")
+	}
+
+	if !strings.EqualFold(claims.HTM, method) {
+		return "", errors.New("proof htm does not match the request method")
+	}
+	if !sameURL(claims.HTU, requestURL) {
+		return "", errors.New("proof htu does not match the request URL")
+	}
+
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		if claims.ATH != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			return "", errors.New("proof ath does not match the access token")
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if claims.Nonce != "" || v.requireNonce {
+		v.rotateNonce()
+		if claims.Nonce == "" || (claims.Nonce != v.nonce && claims.Nonce != v.prevNonce) {
+			return "", ErrUseNonce
+		}
+	}
+
+	for jti, expiresAt := range v.seen {
+		if now.After(expiresAt) {
+			delete(v.seen, jti)
+		}
+	}
+	if _, replayed := v.seen[claims.ID]; replayed {
+		return "", errors.New("proof has already been used")
+	}
+	v.seen[claims.ID] = claims.IssuedAt.Time.Add(proofMaxAge + clockSkew)
+
+	return jkt, nil
+}
+
+// rotateNonce must be called with v.mu held. The previous nonce stays valid
+// for one more period so clients that just fetched it are not rejected.
+func (v *Verifier) rotateNonce() {
+	if v.nonce != "" && time.Since(v.rotatedAt) < nonceLifetime {
+		return
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return
+	}
+	v.prevNonce = v.nonce
+	v.nonce = base64.RawURLEncoding.EncodeToString(b)
+	v.rotatedAt = time.Now()
+}
+
+// sameURL compares URLs without their query and fragment, as RFC 9449
+// requires for htu.
+func sameURL(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) &&
+		strings.EqualFold(ua.Host, ub.Host) &&
+		ua.EscapedPath() == ub.EscapedPath()
+}
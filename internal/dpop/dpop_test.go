@@ -0,0 +1,132 @@
+package dpop
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+
+	"authforge/internal/keyring"
+)
+
+const (
+	testURL         = "https://auth.example.com/api/v1/me"
+	testAccessToken = "access-token"
+)
+
+func signProof(t *testing.T, key *ecdsa.PrivateKey, typ string, claims *proofClaims) string {
+	t.Helper()
+	jwk, _ := keyring.PublicJWK(&key.PublicKey)
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = typ
+	token.Header["jwk"] = jwk
+	proof, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+func accessTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestVerify(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, _ := keyring.PublicJWK(&key.PublicKey)
+	wantJKT, err := keyring.Thumbprint(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		typ         string
+		htm         string
+		htu         string
+		ath         string
+		accessToken string
+		wantErr     bool
+	}{
+		{name: "token request", htm: "POST", htu: testURL},
+		{name: "resource request", htm: "GET", htu: testURL, ath: accessTokenHash(testAccessToken), accessToken: testAccessToken},
+		{name: "htu query and fragment are ignored", htm: "GET", htu: testURL + "?page=2#top", ath: accessTokenHash(testAccessToken), accessToken: testAccessToken},
+		{name: "htu scheme and host are case-insensitive", htm: "GET", htu: "HTTPS://Auth.Example.com/api/v1/me", ath: accessTokenHash(testAccessToken), accessToken: testAccessToken},
+		{name: "missing ath", htm: "GET", htu: testURL, accessToken: testAccessToken, wantErr: true},
+		{name: "ath of another token", htm: "GET", htu: testURL, ath: accessTokenHash("other-token"), accessToken: testAccessToken, wantErr: true},
+		{name: "htu of another path", htm: "GET", htu: "https://auth.example.com/api/v1/admin/users", ath: accessTokenHash(testAccessToken), accessToken: testAccessToken, wantErr: true},
+		{name: "htu of another host", htm: "GET", htu: "https://evil.example.com/api/v1/me", ath: accessTokenHash(testAccessToken), accessToken: testAccessToken, wantErr: true},
+		{name: "htu of another scheme", htm: "GET", htu: "http://auth.example.com/api/v1/me", ath: accessTokenHash(testAccessToken), accessToken: testAccessToken, wantErr: true},
+		{name: "htm mismatch", htm: "POST", htu: testURL, ath: accessTokenHash(testAccessToken), accessToken: testAccessToken, wantErr: true},
+		{name: "wrong typ", typ: "JWT", htm: "POST", htu: testURL, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			typ := tt.typ
+			if typ == "" {
+				typ = proofTokenType
+			}
+			proof := signProof(t, key, typ, &proofClaims{
+				HTM: tt.htm,
+				HTU: tt.htu,
+				ATH: tt.ath,
+				RegisteredClaims: jwt.RegisteredClaims{
+					ID:       uuid.NewString(),
+					IssuedAt: jwt.NewNumericDate(time.Now()),
+				},
+			})
+
+			method := "GET"
+			if tt.accessToken == "" {
+				method = "POST"
+			}
+			jkt, err := NewVerifier(false).Verify(proof, method, testURL, tt.accessToken)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("proof accepted, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("proof rejected: %v", err)
+			}
+			if jkt != wantJKT {
+				t.Fatalf("jkt = %q, want the thumbprint of the proof key %q", jkt, wantJKT)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsReplay(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof := signProof(t, key, proofTokenType, &proofClaims{
+		HTM: "POST",
+		HTU: testURL,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       uuid.NewString(),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+	})
+
+	v := NewVerifier(false)
+	if _, err := v.Verify(proof, "POST", testURL, ""); err != nil {
+		t.Fatalf("proof rejected: %v", err)
+	}
+	if _, err := v.Verify(proof, "POST", testURL, ""); err == nil {
+		t.Fatal("replayed proof accepted")
+	}
+}
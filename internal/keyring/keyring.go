@@ -0,0 +1,291 @@
+package keyring
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"authforge/config"
+	"authforge/internal/logger"
+	"authforge/internal/models"
+)
+
+type Key struct {
+	ID         string
+	Algorithm  string
+	PrivateKey interface{}
+	PublicKey  interface{}
+}
+
+func (k *Key) Method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+func (k *Key) CanSign() bool {
+	return k.PrivateKey != nil
+}
+
+// IsSymmetric reports whether the key is a shared HMAC secret. Only AuthForge
+// itself can verify what such a key signs.
+func (k *Key) IsSymmetric() bool {
+	_, ok := k.PublicKey.([]byte)
+	return ok
+}
+
+type Keyring struct {
+	mu     sync.RWMutex
+	keys   map[string]*Key
+	active *Key
+}
+
+func New(active *Key, verifyOnly ...*Key) (*Keyring, error) {
+	if active == nil || !active.CanSign() {
+		return nil, errors.New("active key must have a private key")
+	}
+
+	kr := &Keyring{keys: map[string]*Key{active.ID: active}, active: active}
+	for _, key := range verifyOnly {
+		if _, exists := kr.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		kr.keys[key.ID] = &Key{ID: key.ID, Algorithm: key.Algorithm, PublicKey: key.PublicKey}
+	}
+	return kr, nil
+}
+
+// Load builds the keyring from the keys stored in Postgres, JWT_KEYS_DIR and
+// JWT_SECRET, in that order of precedence. In JWT_KEYS_DIR every PEM file is a
+// key whose id is the file name. The first source that has an active key
+// signs; keys from the others stay around as verify-only keys so tokens
+// issued before a switch keep working. Retired stored keys are left out.
+func Load(cfg *config.Config, stored []*models.SigningKey) (*Keyring, error) {
+	var active *Key
+	var verifyOnly []*Key
+	for _, sk := range stored {
+		if sk.Status == models.SigningKeyRetired {
+			continue
+		}
+		key, err := OpenStored(cfg.KeyEncryptionKey, sk)
+		if err != nil {
+			return nil, fmt.Errorf("stored key %s: %w", sk.ID, err)
+		}
+		if sk.Status == models.SigningKeyActive {
+			active = key
+			continue
+		}
+		verifyOnly = append(verifyOnly, key)
+	}
+
+	var hmacKey *Key
+	if cfg.JWTSecret != "" {
+		hmacKey = &Key{
+			Algorithm:  jwt.SigningMethodHS256.Alg(),
+			PrivateKey: []byte(cfg.JWTSecret),
+			PublicKey:  []byte(cfg.JWTSecret),
+		}
+	}
+
+	if cfg.JWTKeysDir != "" {
+		keys, err := loadDir(cfg.JWTKeysDir)
+		if err != nil {
+			return nil, err
+		}
+
+		if active != nil {
+			verifyOnly = append(verifyOnly, keys...)
+		} else {
+			dirActive, dirVerifyOnly, err := pickActive(keys, cfg)
+			if err != nil {
+				return nil, err
+			}
+			active = dirActive
+			verifyOnly = append(verifyOnly, dirVerifyOnly...)
+		}
+	}
+
+	if hmacKey != nil {
+		if active == nil {
+			logger.Info("Using HS256 signing key from JWT_SECRET")
+			return New(hmacKey, verifyOnly...)
+		}
+		verifyOnly = append(verifyOnly, hmacKey)
+	}
+
+	if active == nil {
+		return nil, errors.New("no signing key configured: set JWT_SECRET or JWT_KEYS_DIR, or activate a key with authforge keys rotate")
+	}
+
+	logger.Info("Using ", active.Algorithm, " signing key ", active.ID, " with ", len(verifyOnly), " verify-only keys")
+	return New(active, verifyOnly...)
+}
+
+func pickActive(keys []*Key, cfg *config.Config) (*Key, []*Key, error) {
+	activeID := cfg.JWTActiveKeyID
+	if activeID == "" {
+		var signers []string
+		for _, key := range keys {
+			if key.CanSign() {
+				signers = append(signers, key.ID)
+			}
+		}
+		if len(signers) != 1 {
+			return nil, nil, errors.New("JWT_ACTIVE_KEY_ID is required when JWT_KEYS_DIR holds zero or several private keys")
+		}
+		activeID = signers[0]
+	}
+
+	var active *Key
+	var verifyOnly []*Key
+	for _, key := range keys {
+		if key.ID == activeID {
+			active = key
+			continue
+		}
+		verifyOnly = append(verifyOnly, key)
+	}
+	if active == nil {
+		return nil, nil, fmt.Errorf("active key %q not found in %s", activeID, cfg.JWTKeysDir)
+	}
+	return active, verifyOnly, nil
+}
+
+// Replace swaps in the keys of another keyring, letting a running server pick
+// up rotated keys without a restart.
+func (kr *Keyring) Replace(other *Keyring) {
+	other.mu.RLock()
+	keys, active := other.keys, other.active
+	other.mu.RUnlock()
+
+	kr.mu.Lock()
+	kr.keys, kr.active = keys, active
+	kr.mu.Unlock()
+}
+
+func (kr *Keyring) SigningKey() *Key {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.active
+}
+
+func (kr *Keyring) Lookup(kid string) (*Key, bool) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	key, ok := kr.keys[kid]
+	return key, ok
+}
+
+func (kr *Keyring) Keys() []*Key {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	keys := make([]*Key, 0, len(kr.keys))
+	for _, key := range kr.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+func loadDir(dir string) ([]*Key, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no *.pem keys found in %s", dir)
+	}
+
+	keys := make([]*Key, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logger.Error("Error reading key file ", path, ": ", err)
+			return nil, err
+		}
+		key, err := ParsePEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", path, err)
+		}
+		key.ID = strings.TrimSuffix(filepath.Base(path), ".pem")
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func ParsePEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newKey(parsed)
+}
+
+func newKey(parsed interface{}) (*Key, error) {
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{Algorithm: jwt.SigningMethodRS256.Alg(), PrivateKey: k, PublicKey: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{Algorithm: jwt.SigningMethodRS256.Alg(), PublicKey: k}, nil
+	case *ecdsa.PrivateKey:
+		alg, err := ecdsaAlgorithm(k.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{Algorithm: alg, PrivateKey: k, PublicKey: &k.PublicKey}, nil
+	case *ecdsa.PublicKey:
+		alg, err := ecdsaAlgorithm(k.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{Algorithm: alg, PublicKey: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{Algorithm: jwt.SigningMethodEdDSA.Alg(), PrivateKey: k, PublicKey: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{Algorithm: jwt.SigningMethodEdDSA.Alg(), PublicKey: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+func ecdsaAlgorithm(curve elliptic.Curve) (string, error) {
+	switch curve {
+	case elliptic.P256():
+		return jwt.SigningMethodES256.Alg(), nil
+	case elliptic.P384():
+		return jwt.SigningMethodES384.Alg(), nil
+	case elliptic.P521():
+		return jwt.SigningMethodES512.Alg(), nil
+	default:
+		return "", errors.New("unsupported elliptic curve")
+	}
+}
@@ -0,0 +1,123 @@
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"authforge/internal/models"
+)
+
+// Algorithms lists what Generate can create.
+var Algorithms = []string{"RS256", "ES256", "ES384", "EdDSA"}
+
+// Generate creates a new private key for the algorithm, with an id made of
+// the current date and a random suffix.
+func Generate(algorithm string) (*Key, error) {
+	var private interface{}
+	var err error
+	switch algorithm {
+	case "RS256":
+		private, err = rsa.GenerateKey(rand.Reader, 3072)
+	case "ES256":
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		private, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := newKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	key.ID = time.Now().UTC().Format("2006-01-02") + "-" + hex.EncodeToString(suffix)
+	return key, nil
+}
+
+// Seal encrypts a private key for the signing_keys table with AES-256-GCM
+// under KEY_ENCRYPTION_KEY.
+func Seal(encryptionKey string, key *Key) (*models.SigningKey, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return &models.SigningKey{
+		ID:         key.ID,
+		Algorithm:  key.Algorithm,
+		PrivateKey: aead.Seal(nonce, nonce, pemBytes, []byte(key.ID)),
+	}, nil
+}
+
+// OpenStored decrypts a key from the signing_keys table. The key id is bound
+// as additional data, so ciphertexts cannot be swapped between rows.
+func OpenStored(encryptionKey string, sk *models.SigningKey) (*Key, error) {
+	aead, err := newAEAD(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(sk.PrivateKey) < aead.NonceSize() {
+		return nil, errors.New("stored key is too short")
+	}
+
+	nonce, sealed := sk.PrivateKey[:aead.NonceSize()], sk.PrivateKey[aead.NonceSize():]
+	pemBytes, err := aead.Open(nil, nonce, sealed, []byte(sk.ID))
+	if err != nil {
+		return nil, errors.New("cannot decrypt stored key, check KEY_ENCRYPTION_KEY")
+	}
+
+	key, err := ParsePEM(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+	key.ID = sk.ID
+	return key, nil
+}
+
+func newAEAD(encryptionKey string) (cipher.AEAD, error) {
+	if encryptionKey == "" {
+		return nil, errors.New("KEY_ENCRYPTION_KEY is not set")
+	}
+	secret, err := base64.StdEncoding.DecodeString(encryptionKey)
+	if err != nil || len(secret) != 32 {
+		return nil, errors.New("KEY_ENCRYPTION_KEY must be 32 bytes encoded as base64")
+	}
+
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,93 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"authforge/internal/models"
+)
+
+func newEncryptionKey(t *testing.T) string {
+	t.Helper()
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(secret)
+}
+
+func TestSealOpenStored(t *testing.T) {
+	kek := newEncryptionKey(t)
+
+	for _, alg := range Algorithms {
+		t.Run(alg, func(t *testing.T) {
+			key, err := Generate(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored, err := Seal(kek, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			opened, err := OpenStored(kek, stored)
+			if err != nil {
+				t.Fatalf("cannot open sealed key: %v", err)
+			}
+			if opened.ID != key.ID || opened.Algorithm != key.Algorithm {
+				t.Fatalf("opened %s/%s, want %s/%s", opened.ID, opened.Algorithm, key.ID, key.Algorithm)
+			}
+			public := key.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+			if !public.Equal(opened.PublicKey) {
+				t.Fatal("opened key does not match the sealed one")
+			}
+		})
+	}
+}
+
+func TestOpenStoredRejects(t *testing.T) {
+	kek := newEncryptionKey(t)
+	key, err := Generate("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Generate("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := Seal(kek, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	swapped := *stored
+	swapped.ID = other.ID
+	tampered := *stored
+	tampered.PrivateKey = append([]byte{}, stored.PrivateKey...)
+	tampered.PrivateKey[len(tampered.PrivateKey)-1] ^= 1
+	truncated := *stored
+	truncated.PrivateKey = stored.PrivateKey[:4]
+
+	tests := []struct {
+		name   string
+		kek    string
+		stored *models.SigningKey
+	}{
+		{name: "ciphertext moved to another kid", kek: kek, stored: &swapped},
+		{name: "tampered ciphertext", kek: kek, stored: &tampered},
+		{name: "truncated ciphertext", kek: kek, stored: &truncated},
+		{name: "wrong encryption key", kek: newEncryptionKey(t), stored: stored},
+		{name: "encryption key not set", kek: "", stored: stored},
+		{name: "encryption key too short", kek: base64.StdEncoding.EncodeToString([]byte("short")), stored: stored},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := OpenStored(tt.kek, tt.stored); err == nil {
+				t.Fatal("stored key opened, want an error")
+			}
+		})
+	}
+}
@@ -11,6 +11,9 @@ import (
 type Mailer interface {
 	SendConfirmationEmail(to, token string) error
 	SendPasswordResetEmail(to, token string) error
+	SendEmailChangeConfirmation(to, token string) error
+	SendEmailChangedNotice(to, newEmail, revertToken string) error
+	SendDataExportEmail(to, downloadURL string) error
 }
 
 type smtpMailer struct {
@@ -51,6 +54,50 @@ func (m *smtpMailer) SendPasswordResetEmail(to, token string) error {
 	return err
 }
 
+func (m *smtpMailer) SendEmailChangeConfirmation(to, token string) error {
+	subject := "Confirm Your New Email Address"
+	confirmationURL := fmt.Sprintf("%s/api/v1/me/email/confirm?token=%s", m.cfg.BaseURL, token)
+	body := fmt.Sprintf("Please confirm your new email address by clicking the link:\n%s\n\nIf you did not request this change, you can ignore this email.", confirmationURL)
+	logger.Info("Sending email change confirmation to ", to)
+	err := m.sendMail(to, subject, body)
+	if err != nil {
+		logger.Error("Error sending email change confirmation to ", to, ": ", err)
+	} else {
+		logger.Info("Email change confirmation sent to ", to)
+	}
+	return err
+}
+
+func (m *smtpMailer) SendEmailChangedNotice(to, newEmail, revertToken string) error {
+	subject := "Your Email Address Was Changed"
+	revertURL := fmt.Sprintf("%s/api/v1/me/email/revert?token=%s", m.cfg.BaseURL, revertToken)
+	body := fmt.Sprintf(
+		"The email address of your account was changed to %s.\n\nIf you did not make this change, restore your old address and sign out all devices by clicking the link:\n%s",
+		newEmail, revertURL,
+	)
+	logger.Info("Sending email change notice to ", to)
+	err := m.sendMail(to, subject, body)
+	if err != nil {
+		logger.Error("Error sending email change notice to ", to, ": ", err)
+	} else {
+		logger.Info("Email change notice sent to ", to)
+	}
+	return err
+}
+
+func (m *smtpMailer) SendDataExportEmail(to, downloadURL string) error {
+	subject := "Your Data Export Is Ready"
+	body := fmt.Sprintf("The export of your personal data is ready. Download it here before the link expires:\n%s", downloadURL)
+	logger.Info("Sending data export email to ", to)
+	err := m.sendMail(to, subject, body)
+	if err != nil {
+		logger.Error("Error sending data export email to ", to, ": ", err)
+	} else {
+		logger.Info("Data export email sent to ", to)
+	}
+	return err
+}
+
 func (m *smtpMailer) sendMail(to, subject, body string) error {
 	from := m.cfg.SMTPUsername
 	password := m.cfg.SMTPPassword
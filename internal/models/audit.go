@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditEventType string
+
+const (
+	AuditLogin                    AuditEventType = "login"
+	AuditAccountDeletionScheduled AuditEventType = "account_deletion_scheduled"
+	AuditAccountDeletionCancelled AuditEventType = "account_deletion_cancelled"
+	AuditAccountDeleted           AuditEventType = "account_deleted"
+)
+
+// AuditEvent records a security relevant action. UserID becomes nil once
+// the user is deleted, leaving an anonymized entry behind.
+type AuditEvent struct {
+	ID        int64          `json:"id" db:"id"`
+	UserID    *uuid.UUID     `json:"userId" db:"user_id"`
+	Event     AuditEventType `json:"event" db:"event"`
+	CreatedAt time.Time      `json:"createdAt" db:"created_at"`
+}
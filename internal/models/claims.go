@@ -0,0 +1,67 @@
+package models
+
+import "encoding/json"
+
+// ReservedClaims lists the claim names AuthForge sets itself; extra claims
+// must never use them.
+var ReservedClaims = map[string]bool{
+	"iss":       true,
+	"sub":       true,
+	"aud":       true,
+	"exp":       true,
+	"nbf":       true,
+	"iat":       true,
+	"jti":       true,
+	"user_id":   true,
+	"role":      true,
+	"token_use": true,
+	"sid":       true,
+	"client_id": true,
+	"scope":     true,
+	"ver":       true,
+	"act":       true,
+	"cnf":       true,
+}
+
+type customClaims CustomClaims
+
+func (c CustomClaims) MarshalJSON() ([]byte, error) {
+	raw, err := json.Marshal(customClaims(c))
+	if err != nil || len(c.Extra) == 0 {
+		return raw, err
+	}
+
+	merged := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &merged); err != nil {
+		return nil, err
+	}
+	for name, value := range c.Extra {
+		if !ReservedClaims[name] {
+			merged[name] = value
+		}
+	}
+	return json.Marshal(merged)
+}
+
+func (c *CustomClaims) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*customClaims)(c)); err != nil {
+		return err
+	}
+
+	var all map[string]interface{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+
+	c.Extra = nil
+	for name, value := range all {
+		if ReservedClaims[name] {
+			continue
+		}
+		if c.Extra == nil {
+			c.Extra = make(map[string]interface{})
+		}
+		c.Extra[name] = value
+	}
+	return nil
+}
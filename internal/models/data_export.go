@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DataExportStatus string
+
+const (
+	DataExportPending DataExportStatus = "pending"
+	DataExportReady   DataExportStatus = "ready"
+	DataExportFailed  DataExportStatus = "failed"
+)
+
+// DataExport is a personal data archive generated in the background and
+// kept until it expires.
+type DataExport struct {
+	ID          uuid.UUID        `json:"id" db:"id"`
+	UserID      uuid.UUID        `json:"userId" db:"user_id"`
+	Status      DataExportStatus `json:"status" db:"status"`
+	Archive     []byte           `json:"-" db:"archive"`
+	ExpiresAt   time.Time        `json:"expiresAt" db:"expires_at"`
+	CreatedAt   time.Time        `json:"createdAt" db:"created_at"`
+	CompletedAt *time.Time       `json:"completedAt" db:"completed_at"`
+}
+
+// TokenMetadata describes an outstanding token without revealing it.
+type TokenMetadata struct {
+	Type      string    `json:"type"`
+	ClientID  string    `json:"clientId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
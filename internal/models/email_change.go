@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EmailChangeToken struct {
+	ID          int64      `json:"id" db:"id"`
+	UserID      uuid.UUID  `json:"userId" db:"user_id"`
+	OldEmail    string     `json:"oldEmail" db:"old_email"`
+	NewEmail    string     `json:"newEmail" db:"new_email"`
+	Token       string     `json:"-" db:"token"`
+	RevertToken *string    `json:"-" db:"revert_token"`
+	ExpiresAt   time.Time  `json:"expiresAt" db:"expires_at"`
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+	ConfirmedAt *time.Time `json:"confirmedAt" db:"confirmed_at"`
+	RevertedAt  *time.Time `json:"revertedAt" db:"reverted_at"`
+}
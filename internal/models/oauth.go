@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type OAuthClient struct {
+	ID           string    `json:"id" db:"id"`
+	Name         string    `json:"name" db:"name"`
+	SecretHash   string    `json:"-" db:"secret_hash"`
+	RedirectURIs []string  `json:"redirectUris" db:"redirect_uris"`
+	Scopes       []string  `json:"scopes" db:"scopes"`
+	Audiences    []string  `json:"audiences" db:"audiences"`
+	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
+}
+
+func (c *OAuthClient) IsConfidential() bool {
+	return c.SecretHash != ""
+}
+
+type AuthorizationCode struct {
+	ID                  int64     `json:"id" db:"id"`
+	Code                string    `json:"code" db:"code"`
+	ClientID            string    `json:"clientId" db:"client_id"`
+	UserID              uuid.UUID `json:"userId" db:"user_id"`
+	RedirectURI         string    `json:"redirectUri" db:"redirect_uri"`
+	Scope               string    `json:"scope" db:"scope"`
+	CodeChallenge       string    `json:"codeChallenge" db:"code_challenge"`
+	CodeChallengeMethod string    `json:"codeChallengeMethod" db:"code_challenge_method"`
+	Nonce               string    `json:"nonce" db:"nonce"`
+	ExpiresAt           time.Time `json:"expiresAt" db:"expires_at"`
+	CreatedAt           time.Time `json:"createdAt" db:"created_at"`
+	Used                bool      `json:"used" db:"used"`
+}
+
+type DeviceCodeStatus string
+
+const (
+	DeviceCodePending  DeviceCodeStatus = "pending"
+	DeviceCodeApproved DeviceCodeStatus = "approved"
+	DeviceCodeDenied   DeviceCodeStatus = "denied"
+	DeviceCodeConsumed DeviceCodeStatus = "consumed"
+)
+
+type DeviceCode struct {
+	ID           int64            `json:"id" db:"id"`
+	DeviceCode   string           `json:"deviceCode" db:"device_code"`
+	UserCode     string           `json:"userCode" db:"user_code"`
+	ClientID     string           `json:"clientId" db:"client_id"`
+	Scope        string           `json:"scope" db:"scope"`
+	UserID       *uuid.UUID       `json:"userId" db:"user_id"`
+	Status       DeviceCodeStatus `json:"status" db:"status"`
+	Interval     int              `json:"interval" db:"poll_interval"`
+	ExpiresAt    time.Time        `json:"expiresAt" db:"expires_at"`
+	LastPolledAt *time.Time       `json:"lastPolledAt" db:"last_polled_at"`
+	CreatedAt    time.Time        `json:"createdAt" db:"created_at"`
+}
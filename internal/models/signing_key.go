@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type SigningKeyStatus string
+
+const (
+	// SigningKeyPending keys are published for verification but do not sign
+	// yet, so verifiers can pick them up before rotation.
+	SigningKeyPending  SigningKeyStatus = "pending"
+	SigningKeyActive   SigningKeyStatus = "active"
+	SigningKeyInactive SigningKeyStatus = "inactive"
+	// SigningKeyRetired keys are no longer trusted and wait to be purged.
+	SigningKeyRetired SigningKeyStatus = "retired"
+)
+
+type SigningKey struct {
+	ID          string           `json:"id" db:"id"`
+	Algorithm   string           `json:"algorithm" db:"algorithm"`
+	PrivateKey  []byte           `json:"-" db:"private_key"`
+	Status      SigningKeyStatus `json:"status" db:"status"`
+	CreatedAt   time.Time        `json:"createdAt" db:"created_at"`
+	ActivatedAt *time.Time       `json:"activatedAt" db:"activated_at"`
+	RetiredAt   *time.Time       `json:"retiredAt" db:"retired_at"`
+}
@@ -22,3 +22,20 @@ type PasswordResetToken struct {
 	CreatedAt time.Time `json:"createdAt" db:"created_at"`
 	Used      bool      `json:"used" db:"used"`
 }
+
+type RefreshToken struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"userId" db:"user_id"`
+	SessionID uuid.UUID  `json:"sessionId" db:"session_id"`
+	ExpiresAt time.Time  `json:"expiresAt" db:"expires_at"`
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+	RotatedAt *time.Time `json:"rotatedAt" db:"rotated_at"`
+}
+
+type OpaqueToken struct {
+	TokenHash string     `json:"-" db:"token_hash"`
+	UserID    *uuid.UUID `json:"userId" db:"user_id"`
+	Claims    []byte     `json:"-" db:"claims"`
+	ExpiresAt time.Time  `json:"expiresAt" db:"expires_at"`
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+}
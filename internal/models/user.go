@@ -24,10 +24,68 @@ type User struct {
 	UpdatedAt           time.Time `json:"updatedAt" db:"updated_at"`
 	FailedLoginAttempts int       `json:"failedLoginAttempts" db:"failed_login_attempts"`
 	LastFailedLogin     time.Time `json:"lastFailedLogin" db:"last_failed_login"`
+	TokenVersion        int       `json:"-" db:"token_version"`
+	EmailVerified       bool      `json:"emailVerified" db:"email_verified"`
+	DisplayName         string    `json:"displayName" db:"display_name"`
+	Locale              string    `json:"locale" db:"locale"`
+
+	// DeletionScheduledAt is set while the user's account waits to be
+	// deleted.
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt,omitempty" db:"deletion_scheduled_at"`
+}
+
+// UserFilter narrows down a user listing. Zero fields do not filter; Email
+// matches any part of the address, ignoring case.
+type UserFilter struct {
+	Role          *UserRole
+	IsActive      *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Email         string
+	Limit         int
+	Offset        int
 }
 
+type TokenUse string
+
+const (
+	TokenUseAccess  TokenUse = "access"
+	TokenUseRefresh TokenUse = "refresh"
+)
+
 type CustomClaims struct {
-	UserID string `json:"user_id"`
-	Role   string `json:"role"`
+	UserID    string        `json:"user_id"`
+	Role      string        `json:"role"`
+	TokenUse  TokenUse      `json:"token_use"`
+	SessionID string        `json:"sid"`
+	ClientID  string        `json:"client_id,omitempty"`
+	Scope     string        `json:"scope,omitempty"`
+	Version   int           `json:"ver"`
+	Act       *Actor        `json:"act,omitempty"`
+	Cnf       *Confirmation `json:"cnf,omitempty"`
+	jwt.RegisteredClaims
+
+	// Extra holds claims added by claims providers. They are flattened into
+	// the top level of the token next to the standard claims.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// Actor identifies the party acting on behalf of the subject of a token
+// obtained through token exchange. Act holds the previous actor, if any.
+type Actor struct {
+	Subject string `json:"sub"`
+	Act     *Actor `json:"act,omitempty"`
+}
+
+// Confirmation binds a token to the DPoP key with the given thumbprint.
+type Confirmation struct {
+	JKT string `json:"jkt"`
+}
+
+type IDTokenClaims struct {
+	Email         string           `json:"email"`
+	EmailVerified bool             `json:"email_verified"`
+	Nonce         string           `json:"nonce,omitempty"`
+	AuthTime      *jwt.NumericDate `json:"auth_time,omitempty"`
 	jwt.RegisteredClaims
 }
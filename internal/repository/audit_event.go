@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"authforge/internal/logger"
+	"authforge/internal/models"
+
+	"github.com/google/uuid"
+)
+
+type AuditEventRepository interface {
+	RecordEvent(event *models.AuditEvent) error
+	ListUserEvents(userID uuid.UUID) ([]*models.AuditEvent, error)
+}
+
+type PostgresAuditEventRepository struct {
+	DB *sql.DB
+}
+
+func NewAuditEventRepository(db *sql.DB) AuditEventRepository {
+	return &PostgresAuditEventRepository{DB: db}
+}
+
+func (r *PostgresAuditEventRepository) RecordEvent(event *models.AuditEvent) error {
+	query := `
+		INSERT INTO audit_events (user_id, event, created_at)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`
+	event.CreatedAt = time.Now()
+	err := r.DB.QueryRow(query, event.UserID, event.Event, event.CreatedAt).Scan(&event.ID)
+	if err != nil {
+		logger.Error("Error recording audit event ", event.Event, ": ", err)
+	}
+	return err
+}
+
+func (r *PostgresAuditEventRepository) ListUserEvents(userID uuid.UUID) ([]*models.AuditEvent, error) {
+	query := `
+		SELECT id, user_id, event, created_at
+		FROM audit_events
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+	rows, err := r.DB.Query(query, userID)
+	if err != nil {
+		logger.Error("Error listing audit events of user ", userID, ": ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.AuditEvent
+	for rows.Next() {
+		event := &models.AuditEvent{}
+		if err := rows.Scan(&event.ID, &event.UserID, &event.Event, &event.CreatedAt); err != nil {
+			logger.Error("Error scanning audit event: ", err)
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
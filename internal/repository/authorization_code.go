@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"authforge/internal/logger"
+	"authforge/internal/models"
+)
+
+type AuthorizationCodeRepository interface {
+	CreateCode(code *models.AuthorizationCode) error
+	GetCode(code string) (*models.AuthorizationCode, error)
+	MarkCodeUsed(code string) (bool, error)
+}
+
+type PostgresAuthorizationCodeRepository struct {
+	DB *sql.DB
+}
+
+func NewAuthorizationCodeRepository(db *sql.DB) AuthorizationCodeRepository {
+	return &PostgresAuthorizationCodeRepository{DB: db}
+}
+
+func (r *PostgresAuthorizationCodeRepository) CreateCode(code *models.AuthorizationCode) error {
+	query := `
+		INSERT INTO authorization_codes (
+			code, client_id, user_id, redirect_uri, scope,
+			code_challenge, code_challenge_method, nonce, expires_at, created_at, used
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+	code.CreatedAt = time.Now()
+	code.Used = false
+	_, err := r.DB.Exec(query,
+		code.Code,
+		code.ClientID,
+		code.UserID,
+		code.RedirectURI,
+		code.Scope,
+		code.CodeChallenge,
+		code.CodeChallengeMethod,
+		code.Nonce,
+		code.ExpiresAt,
+		code.CreatedAt,
+		code.Used,
+	)
+	if err != nil {
+		logger.Error("Error creating authorization code for client ", code.ClientID, ": ", err)
+	}
+	return err
+}
+
+func (r *PostgresAuthorizationCodeRepository) GetCode(code string) (*models.AuthorizationCode, error) {
+	query := `
+		SELECT id, code, client_id, user_id, redirect_uri, scope,
+			code_challenge, code_challenge_method, nonce, expires_at, created_at, used
+		FROM authorization_codes
+		WHERE code = $1
+	`
+	ac := &models.AuthorizationCode{}
+	err := r.DB.QueryRow(query, code).Scan(
+		&ac.ID,
+		&ac.Code,
+		&ac.ClientID,
+		&ac.UserID,
+		&ac.RedirectURI,
+		&ac.Scope,
+		&ac.CodeChallenge,
+		&ac.CodeChallengeMethod,
+		&ac.Nonce,
+		&ac.ExpiresAt,
+		&ac.CreatedAt,
+		&ac.Used,
+	)
+	if err != nil {
+		logger.Error("Error fetching authorization code: ", err)
+		return nil, err
+	}
+	return ac, nil
+}
+
+// MarkCodeUsed reports false when the code had already been redeemed.
+func (r *PostgresAuthorizationCodeRepository) MarkCodeUsed(code string) (bool, error) {
+	query := `UPDATE authorization_codes SET used = true WHERE code = $1 AND used = false`
+	res, err := r.DB.Exec(query, code)
+	if err != nil {
+		logger.Error("Error marking authorization code as used: ", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading used authorization code count: ", err)
+		return false, err
+	}
+	return n == 1, nil
+}
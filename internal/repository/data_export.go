@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"authforge/internal/logger"
+	"authforge/internal/models"
+
+	"github.com/google/uuid"
+)
+
+type DataExportRepository interface {
+	CreateExport(export *models.DataExport) error
+	GetExport(id uuid.UUID) (*models.DataExport, error)
+	GetRecentExport(userID uuid.UUID, since time.Time) (*models.DataExport, error)
+	CompleteExport(id uuid.UUID, archive []byte) error
+	FailExport(id uuid.UUID) error
+	DeleteExpiredExports(before time.Time) (int64, error)
+	CountUserRecords(userID uuid.UUID) (int, error)
+	ListPendingTokens(userID uuid.UUID) ([]*models.TokenMetadata, error)
+}
+
+type PostgresDataExportRepository struct {
+	DB *sql.DB
+}
+
+func NewDataExportRepository(db *sql.DB) DataExportRepository {
+	return &PostgresDataExportRepository{DB: db}
+}
+
+func (r *PostgresDataExportRepository) CreateExport(export *models.DataExport) error {
+	query := `
+		INSERT INTO data_exports (id, user_id, status, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	export.CreatedAt = time.Now()
+	_, err := r.DB.Exec(query, export.ID, export.UserID, export.Status, export.ExpiresAt, export.CreatedAt)
+	if err != nil {
+		logger.Error("Error creating data export for user ", export.UserID, ": ", err)
+	}
+	return err
+}
+
+func (r *PostgresDataExportRepository) GetExport(id uuid.UUID) (*models.DataExport, error) {
+	query := `
+		SELECT id, user_id, status, archive, expires_at, created_at, completed_at
+		FROM data_exports
+		WHERE id = $1
+	`
+	export := &models.DataExport{}
+	err := r.DB.QueryRow(query, id).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.Archive,
+		&export.ExpiresAt,
+		&export.CreatedAt,
+		&export.CompletedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("Data export not found with ID ", id)
+			return nil, errors.New("export not found")
+		}
+		logger.Error("Error fetching data export ", id, ": ", err)
+		return nil, err
+	}
+	return export, nil
+}
+
+// GetRecentExport returns the user's newest unexpired export that is still
+// being built or was created after since, or nil when there is none.
+func (r *PostgresDataExportRepository) GetRecentExport(userID uuid.UUID, since time.Time) (*models.DataExport, error) {
+	query := `
+		SELECT id, user_id, status, expires_at, created_at, completed_at
+		FROM data_exports
+		WHERE user_id = $1 AND expires_at > $2
+			AND (status = $3 OR (status = $4 AND created_at >= $5))
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+	export := &models.DataExport{}
+	err := r.DB.QueryRow(query, userID, time.Now(), models.DataExportPending, models.DataExportReady, since).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.ExpiresAt,
+		&export.CreatedAt,
+		&export.CompletedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.Error("Error fetching recent data export of user ", userID, ": ", err)
+		return nil, err
+	}
+	return export, nil
+}
+
+func (r *PostgresDataExportRepository) CompleteExport(id uuid.UUID, archive []byte) error {
+	query := `UPDATE data_exports SET status = $1, archive = $2, completed_at = $3 WHERE id = $4`
+	_, err := r.DB.Exec(query, models.DataExportReady, archive, time.Now(), id)
+	if err != nil {
+		logger.Error("Error completing data export ", id, ": ", err)
+	}
+	return err
+}
+
+func (r *PostgresDataExportRepository) FailExport(id uuid.UUID) error {
+	query := `UPDATE data_exports SET status = $1, completed_at = $2 WHERE id = $3`
+	_, err := r.DB.Exec(query, models.DataExportFailed, time.Now(), id)
+	if err != nil {
+		logger.Error("Error marking data export ", id, " as failed: ", err)
+	}
+	return err
+}
+
+func (r *PostgresDataExportRepository) DeleteExpiredExports(before time.Time) (int64, error) {
+	query := `DELETE FROM data_exports WHERE expires_at <= $1`
+	res, err := r.DB.Exec(query, before)
+	if err != nil {
+		logger.Error("Error deleting expired data exports: ", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CountUserRecords returns how many sessions and audit events a user has,
+// the parts of an export that grow without bound.
+func (r *PostgresDataExportRepository) CountUserRecords(userID uuid.UUID) (int, error) {
+	query := `
+		SELECT (SELECT COUNT(*) FROM sessions WHERE user_id = $1)
+			+ (SELECT COUNT(*) FROM audit_events WHERE user_id = $1)
+	`
+	var n int
+	if err := r.DB.QueryRow(query, userID).Scan(&n); err != nil {
+		logger.Error("Error counting records of user ", userID, ": ", err)
+		return 0, err
+	}
+	return n, nil
+}
+
+// ListPendingTokens returns the unused, unexpired tokens issued to a user
+// across all token tables. The token values themselves are not read.
+func (r *PostgresDataExportRepository) ListPendingTokens(userID uuid.UUID) ([]*models.TokenMetadata, error) {
+	query := `
+		SELECT 'confirmation', '', created_at, expires_at FROM confirmation_tokens
+		WHERE user_id = $1 AND expires_at > $2
+		UNION ALL
+		SELECT 'password_reset', '', created_at, expires_at FROM password_reset_tokens
+		WHERE user_id = $1 AND used IS NOT TRUE AND expires_at > $2
+		UNION ALL
+		SELECT 'email_change', '', created_at, expires_at FROM email_change_tokens
+		WHERE user_id = $1 AND confirmed_at IS NULL AND expires_at > $2
+		UNION ALL
+		SELECT 'refresh', s.client_id, rt.created_at, rt.expires_at FROM refresh_tokens rt
+		JOIN sessions s ON s.id = rt.session_id
+		WHERE rt.user_id = $1 AND rt.rotated_at IS NULL AND s.revoked_at IS NULL AND rt.expires_at > $2
+		UNION ALL
+		SELECT 'authorization_code', client_id, created_at, expires_at FROM authorization_codes
+		WHERE user_id = $1 AND used IS NOT TRUE AND expires_at > $2
+		UNION ALL
+		SELECT 'device_code', client_id, created_at, expires_at FROM device_codes
+		WHERE user_id = $1 AND expires_at > $2
+		UNION ALL
+		SELECT 'opaque_token', '', created_at, expires_at FROM opaque_tokens
+		WHERE user_id = $1 AND expires_at > $2
+		ORDER BY 3
+	`
+	rows, err := r.DB.Query(query, userID, time.Now())
+	if err != nil {
+		logger.Error("Error listing pending tokens of user ", userID, ": ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*models.TokenMetadata
+	for rows.Next() {
+		token := &models.TokenMetadata{}
+		if err := rows.Scan(&token.Type, &token.ClientID, &token.CreatedAt, &token.ExpiresAt); err != nil {
+			logger.Error("Error scanning pending token: ", err)
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
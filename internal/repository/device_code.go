@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"authforge/internal/logger"
+	"authforge/internal/models"
+
+	"github.com/google/uuid"
+)
+
+type DeviceCodeRepository interface {
+	CreateCode(code *models.DeviceCode) error
+	GetByDeviceCode(deviceCode string) (*models.DeviceCode, error)
+	GetByUserCode(userCode string) (*models.DeviceCode, error)
+	RecordPoll(id int64, polledAt time.Time, interval int) error
+	Resolve(userCode string, userID uuid.UUID, status models.DeviceCodeStatus) (bool, error)
+	MarkConsumed(id int64) (bool, error)
+}
+
+type PostgresDeviceCodeRepository struct {
+	DB *sql.DB
+}
+
+func NewDeviceCodeRepository(db *sql.DB) DeviceCodeRepository {
+	return &PostgresDeviceCodeRepository{DB: db}
+}
+
+func (r *PostgresDeviceCodeRepository) CreateCode(code *models.DeviceCode) error {
+	query := `
+		INSERT INTO device_codes (device_code, user_code, client_id, scope, status, poll_interval, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	code.CreatedAt = time.Now()
+	code.Status = models.DeviceCodePending
+	_, err := r.DB.Exec(query,
+		code.DeviceCode,
+		code.UserCode,
+		code.ClientID,
+		code.Scope,
+		code.Status,
+		code.Interval,
+		code.ExpiresAt,
+		code.CreatedAt,
+	)
+	if err != nil {
+		logger.Error("Error creating device code for client ", code.ClientID, ": ", err)
+	}
+	return err
+}
+
+func (r *PostgresDeviceCodeRepository) GetByDeviceCode(deviceCode string) (*models.DeviceCode, error) {
+	return r.getBy("device_code", deviceCode)
+}
+
+func (r *PostgresDeviceCodeRepository) GetByUserCode(userCode string) (*models.DeviceCode, error) {
+	return r.getBy("user_code", userCode)
+}
+
+func (r *PostgresDeviceCodeRepository) getBy(column, value string) (*models.DeviceCode, error) {
+	query := `
+		SELECT id, device_code, user_code, client_id, scope, user_id, status, poll_interval, expires_at, last_polled_at, created_at
+		FROM device_codes
+		WHERE ` + column + ` = $1
+	`
+	dc := &models.DeviceCode{}
+	err := r.DB.QueryRow(query, value).Scan(
+		&dc.ID,
+		&dc.DeviceCode,
+		&dc.UserCode,
+		&dc.ClientID,
+		&dc.Scope,
+		&dc.UserID,
+		&dc.Status,
+		&dc.Interval,
+		&dc.ExpiresAt,
+		&dc.LastPolledAt,
+		&dc.CreatedAt,
+	)
+	if err != nil {
+		logger.Error("Error fetching device code by ", column, ": ", err)
+		return nil, err
+	}
+	return dc, nil
+}
+
+func (r *PostgresDeviceCodeRepository) RecordPoll(id int64, polledAt time.Time, interval int) error {
+	query := `UPDATE device_codes SET last_polled_at = $1, poll_interval = $2 WHERE id = $3`
+	_, err := r.DB.Exec(query, polledAt, interval, id)
+	if err != nil {
+		logger.Error("Error recording device code poll: ", err)
+	}
+	return err
+}
+
+// Resolve approves or denies a pending code and reports false when the code
+// was no longer pending.
+func (r *PostgresDeviceCodeRepository) Resolve(userCode string, userID uuid.UUID, status models.DeviceCodeStatus) (bool, error) {
+	query := `
+		UPDATE device_codes SET status = $1, user_id = $2
+		WHERE user_code = $3 AND status = $4
+	`
+	res, err := r.DB.Exec(query, status, userID, userCode, models.DeviceCodePending)
+	if err != nil {
+		logger.Error("Error resolving device code: ", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading resolved device code count: ", err)
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// MarkConsumed reports false when tokens were already issued for the code.
+func (r *PostgresDeviceCodeRepository) MarkConsumed(id int64) (bool, error) {
+	query := `UPDATE device_codes SET status = $1 WHERE id = $2 AND status = $3`
+	res, err := r.DB.Exec(query, models.DeviceCodeConsumed, id, models.DeviceCodeApproved)
+	if err != nil {
+		logger.Error("Error consuming device code: ", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading consumed device code count: ", err)
+		return false, err
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"authforge/internal/logger"
+	"authforge/internal/models"
+
+	"github.com/google/uuid"
+)
+
+type EmailChangeTokenRepository interface {
+	CreateToken(token *models.EmailChangeToken) error
+	GetByToken(token string) (*models.EmailChangeToken, error)
+	GetByRevertToken(revertToken string) (*models.EmailChangeToken, error)
+	DeletePendingTokens(userID uuid.UUID) error
+	MarkConfirmed(id int64, revertToken string) (bool, error)
+	MarkReverted(id int64) (bool, error)
+}
+
+type PostgresEmailChangeTokenRepository struct {
+	DB *sql.DB
+}
+
+func NewEmailChangeTokenRepository(db *sql.DB) EmailChangeTokenRepository {
+	return &PostgresEmailChangeTokenRepository{DB: db}
+}
+
+func (r *PostgresEmailChangeTokenRepository) CreateToken(token *models.EmailChangeToken) error {
+	query := `
+		INSERT INTO email_change_tokens (user_id, old_email, new_email, token, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+	token.CreatedAt = time.Now()
+	err := r.DB.QueryRow(query, token.UserID, token.OldEmail, token.NewEmail, token.Token, token.ExpiresAt, token.CreatedAt).Scan(&token.ID)
+	if err != nil {
+		logger.Error("Error creating email change token for user ", token.UserID, ": ", err)
+	}
+	return err
+}
+
+func (r *PostgresEmailChangeTokenRepository) GetByToken(token string) (*models.EmailChangeToken, error) {
+	return r.getBy("token", token)
+}
+
+func (r *PostgresEmailChangeTokenRepository) GetByRevertToken(revertToken string) (*models.EmailChangeToken, error) {
+	return r.getBy("revert_token", revertToken)
+}
+
+func (r *PostgresEmailChangeTokenRepository) getBy(column, value string) (*models.EmailChangeToken, error) {
+	query := `
+		SELECT id, user_id, old_email, new_email, token, revert_token, expires_at, created_at, confirmed_at, reverted_at
+		FROM email_change_tokens
+		WHERE ` + column + ` = $1
+	`
+	t := &models.EmailChangeToken{}
+	err := r.DB.QueryRow(query, value).Scan(
+		&t.ID,
+		&t.UserID,
+		&t.OldEmail,
+		&t.NewEmail,
+		&t.Token,
+		&t.RevertToken,
+		&t.ExpiresAt,
+		&t.CreatedAt,
+		&t.ConfirmedAt,
+		&t.RevertedAt,
+	)
+	if err != nil {
+		logger.Error("Error fetching email change token: ", err)
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *PostgresEmailChangeTokenRepository) DeletePendingTokens(userID uuid.UUID) error {
+	query := `DELETE FROM email_change_tokens WHERE user_id = $1 AND confirmed_at IS NULL`
+	_, err := r.DB.Exec(query, userID)
+	if err != nil {
+		logger.Error("Error deleting pending email changes for user ", userID, ": ", err)
+	}
+	return err
+}
+
+// MarkConfirmed reports false when the change was already confirmed.
+func (r *PostgresEmailChangeTokenRepository) MarkConfirmed(id int64, revertToken string) (bool, error) {
+	query := `
+		UPDATE email_change_tokens SET confirmed_at = $1, revert_token = $2
+		WHERE id = $3 AND confirmed_at IS NULL
+	`
+	res, err := r.DB.Exec(query, time.Now(), revertToken, id)
+	if err != nil {
+		logger.Error("Error confirming email change ", id, ": ", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading confirmed email change count: ", err)
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// MarkReverted reports false when the change was not confirmed or was
+// already reverted.
+func (r *PostgresEmailChangeTokenRepository) MarkReverted(id int64) (bool, error) {
+	query := `
+		UPDATE email_change_tokens SET reverted_at = $1
+		WHERE id = $2 AND confirmed_at IS NOT NULL AND reverted_at IS NULL
+	`
+	res, err := r.DB.Exec(query, time.Now(), id)
+	if err != nil {
+		logger.Error("Error reverting email change ", id, ": ", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading reverted email change count: ", err)
+		return false, err
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"authforge/internal/logger"
+	"authforge/internal/models"
+
+	"github.com/lib/pq"
+)
+
+type OAuthClientRepository interface {
+	GetClientByID(id string) (*models.OAuthClient, error)
+}
+
+type PostgresOAuthClientRepository struct {
+	DB *sql.DB
+}
+
+func NewOAuthClientRepository(db *sql.DB) OAuthClientRepository {
+	return &PostgresOAuthClientRepository{DB: db}
+}
+
+func (r *PostgresOAuthClientRepository) GetClientByID(id string) (*models.OAuthClient, error) {
+	query := `
+		SELECT id, name, secret_hash, redirect_uris, scopes, audiences, created_at
+		FROM oauth_clients
+		WHERE id = $1
+	`
+	client := &models.OAuthClient{}
+	err := r.DB.QueryRow(query, id).Scan(
+		&client.ID,
+		&client.Name,
+		&client.SecretHash,
+		pq.Array(&client.RedirectURIs),
+		pq.Array(&client.Scopes),
+		pq.Array(&client.Audiences),
+		&client.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("OAuth client not found with ID ", id)
+			return nil, errors.New("client not found")
+		}
+		logger.Error("Error fetching OAuth client ", id, ": ", err)
+		return nil, err
+	}
+	return client, nil
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"authforge/internal/logger"
+	"authforge/internal/models"
+)
+
+type OpaqueTokenRepository interface {
+	CreateToken(token *models.OpaqueToken) error
+	GetTokenByHash(hash string) (*models.OpaqueToken, error)
+	DeleteExpiredTokens(before time.Time) (int64, error)
+}
+
+type PostgresOpaqueTokenRepository struct {
+	DB *sql.DB
+}
+
+func NewOpaqueTokenRepository(db *sql.DB) OpaqueTokenRepository {
+	return &PostgresOpaqueTokenRepository{DB: db}
+}
+
+func (r *PostgresOpaqueTokenRepository) CreateToken(token *models.OpaqueToken) error {
+	query := `
+		INSERT INTO opaque_tokens (token_hash, user_id, claims, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	token.CreatedAt = time.Now()
+	_, err := r.DB.Exec(query, token.TokenHash, token.UserID, token.Claims, token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		logger.Error("Error creating opaque token: ", err)
+	}
+	return err
+}
+
+func (r *PostgresOpaqueTokenRepository) GetTokenByHash(hash string) (*models.OpaqueToken, error) {
+	query := `
+		SELECT token_hash, user_id, claims, expires_at, created_at
+		FROM opaque_tokens
+		WHERE token_hash = $1
+	`
+	ot := &models.OpaqueToken{}
+	err := r.DB.QueryRow(query, hash).Scan(
+		&ot.TokenHash,
+		&ot.UserID,
+		&ot.Claims,
+		&ot.ExpiresAt,
+		&ot.CreatedAt,
+	)
+	if err != nil {
+		logger.Error("Error fetching opaque token: ", err)
+		return nil, err
+	}
+	return ot, nil
+}
+
+func (r *PostgresOpaqueTokenRepository) DeleteExpiredTokens(before time.Time) (int64, error) {
+	query := `DELETE FROM opaque_tokens WHERE expires_at <= $1`
+	res, err := r.DB.Exec(query, before)
+	if err != nil {
+		logger.Error("Error deleting expired opaque tokens: ", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -6,12 +6,15 @@ import (
 
 	"authforge/internal/logger"
 	"authforge/internal/models"
+
+	"github.com/google/uuid"
 )
 
 type PasswordResetTokenRepository interface {
 	CreateToken(token *models.PasswordResetToken) error
 	GetToken(token string) (*models.PasswordResetToken, error)
 	MarkTokenUsed(token string) error
+	InvalidateUserTokens(userID uuid.UUID) error
 }
 
 type PostgresPasswordResetTokenRepository struct {
@@ -66,3 +69,12 @@ func (r *PostgresPasswordResetTokenRepository) MarkTokenUsed(tokenStr string) er
 	}
 	return err
 }
+
+func (r *PostgresPasswordResetTokenRepository) InvalidateUserTokens(userID uuid.UUID) error {
+	query := `UPDATE password_reset_tokens SET used = TRUE WHERE user_id = $1 AND used = FALSE`
+	_, err := r.DB.Exec(query, userID)
+	if err != nil {
+		logger.Error("Error invalidating password reset tokens for user ", userID, ": ", err)
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"authforge/internal/logger"
+	"authforge/internal/models"
+
+	"github.com/google/uuid"
+)
+
+type RefreshTokenRepository interface {
+	CreateToken(token *models.RefreshToken) error
+	GetTokenByID(id uuid.UUID) (*models.RefreshToken, error)
+	MarkTokenRotated(id uuid.UUID) (bool, error)
+	DeleteExpiredTokens(before time.Time) (int64, error)
+}
+
+type PostgresRefreshTokenRepository struct {
+	DB *sql.DB
+}
+
+func NewRefreshTokenRepository(db *sql.DB) RefreshTokenRepository {
+	return &PostgresRefreshTokenRepository{DB: db}
+}
+
+func (r *PostgresRefreshTokenRepository) CreateToken(token *models.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (id, user_id, session_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	token.CreatedAt = time.Now()
+	_, err := r.DB.Exec(query, token.ID, token.UserID, token.SessionID, token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		logger.Error("Error creating refresh token for user ", token.UserID, ": ", err)
+	}
+	return err
+}
+
+func (r *PostgresRefreshTokenRepository) GetTokenByID(id uuid.UUID) (*models.RefreshToken, error) {
+	query := `
+		SELECT id, user_id, session_id, expires_at, created_at, rotated_at
+		FROM refresh_tokens
+		WHERE id = $1
+	`
+	rt := &models.RefreshToken{}
+	err := r.DB.QueryRow(query, id).Scan(
+		&rt.ID,
+		&rt.UserID,
+		&rt.SessionID,
+		&rt.ExpiresAt,
+		&rt.CreatedAt,
+		&rt.RotatedAt,
+	)
+	if err != nil {
+		logger.Error("Error fetching refresh token: ", err)
+		return nil, err
+	}
+	return rt, nil
+}
+
+// MarkTokenRotated reports false when the token was already rotated, which
+// callers must treat as reuse of a stale refresh token.
+func (r *PostgresRefreshTokenRepository) MarkTokenRotated(id uuid.UUID) (bool, error) {
+	query := `
+		UPDATE refresh_tokens SET rotated_at = $1
+		WHERE id = $2 AND rotated_at IS NULL
+	`
+	res, err := r.DB.Exec(query, time.Now(), id)
+	if err != nil {
+		logger.Error("Error marking refresh token as rotated: ", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading rotated refresh token count: ", err)
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// DeleteExpiredTokens removes refresh tokens past their expiry, rotated ones
+// included: they no longer parse, so reuse detection does not need them.
+func (r *PostgresRefreshTokenRepository) DeleteExpiredTokens(before time.Time) (int64, error) {
+	query := `DELETE FROM refresh_tokens WHERE expires_at <= $1`
+	res, err := r.DB.Exec(query, before)
+	if err != nil {
+		logger.Error("Error deleting expired refresh tokens: ", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"authforge/internal/logger"
+)
+
+type RevokedTokenRepository interface {
+	RevokeToken(jti string, expiresAt time.Time) error
+	IsRevoked(jti string) (bool, error)
+	DeleteExpiredTokens(before time.Time) (int64, error)
+}
+
+type PostgresRevokedTokenRepository struct {
+	DB *sql.DB
+}
+
+func NewRevokedTokenRepository(db *sql.DB) RevokedTokenRepository {
+	return &PostgresRevokedTokenRepository{DB: db}
+}
+
+func (r *PostgresRevokedTokenRepository) RevokeToken(jti string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, expires_at, revoked_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING
+	`
+	_, err := r.DB.Exec(query, jti, expiresAt, time.Now())
+	if err != nil {
+		logger.Error("Error revoking token ", jti, ": ", err)
+	}
+	return err
+}
+
+func (r *PostgresRevokedTokenRepository) IsRevoked(jti string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`
+	var revoked bool
+	if err := r.DB.QueryRow(query, jti).Scan(&revoked); err != nil {
+		logger.Error("Error checking revocation of token ", jti, ": ", err)
+		return false, err
+	}
+	return revoked, nil
+}
+
+// DeleteExpiredTokens forgets revocations of tokens that have expired anyway.
+func (r *PostgresRevokedTokenRepository) DeleteExpiredTokens(before time.Time) (int64, error) {
+	query := `DELETE FROM revoked_tokens WHERE expires_at <= $1`
+	res, err := r.DB.Exec(query, before)
+	if err != nil {
+		logger.Error("Error deleting expired revoked tokens: ", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"authforge/internal/logger"
+	"authforge/internal/models"
+
+	"github.com/google/uuid"
+)
+
+type SessionRepository interface {
+	CreateSession(session *models.Session) error
+	GetSessionByID(id uuid.UUID) (*models.Session, error)
+	ExtendSession(id uuid.UUID, expiresAt time.Time) error
+	RevokeSession(id uuid.UUID) error
+	RevokeUserSessions(userID, except uuid.UUID) error
+	ListUserSessions(userID uuid.UUID) ([]*models.Session, error)
+	DeleteExpiredSessions(before time.Time) (int64, error)
+}
+
+type PostgresSessionRepository struct {
+	DB *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) SessionRepository {
+	return &PostgresSessionRepository{DB: db}
+}
+
+func (r *PostgresSessionRepository) CreateSession(session *models.Session) error {
+	query := `
+		INSERT INTO sessions (id, user_id, client_id, scope, dpop_jkt, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	session.CreatedAt = time.Now()
+	_, err := r.DB.Exec(query, session.ID, session.UserID, session.ClientID, session.Scope, session.DPoPJKT, session.CreatedAt, session.ExpiresAt)
+	if err != nil {
+		logger.Error("Error creating session for user ", session.UserID, ": ", err)
+	}
+	return err
+}
+
+func (r *PostgresSessionRepository) GetSessionByID(id uuid.UUID) (*models.Session, error) {
+	query := `
+		SELECT id, user_id, client_id, scope, dpop_jkt, created_at, expires_at, revoked_at
+		FROM sessions
+		WHERE id = $1
+	`
+	session := &models.Session{}
+	err := r.DB.QueryRow(query, id).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.ClientID,
+		&session.Scope,
+		&session.DPoPJKT,
+		&session.CreatedAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Error("Session not found with ID ", id)
+			return nil, errors.New("session not found")
+		}
+		logger.Error("Error fetching session ", id, ": ", err)
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *PostgresSessionRepository) ExtendSession(id uuid.UUID, expiresAt time.Time) error {
+	query := `UPDATE sessions SET expires_at = $1 WHERE id = $2`
+	_, err := r.DB.Exec(query, expiresAt, id)
+	if err != nil {
+		logger.Error("Error extending session ", id, ": ", err)
+	}
+	return err
+}
+
+func (r *PostgresSessionRepository) RevokeSession(id uuid.UUID) error {
+	query := `UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+	_, err := r.DB.Exec(query, time.Now(), id)
+	if err != nil {
+		logger.Error("Error revoking session ", id, ": ", err)
+	}
+	return err
+}
+
+func (r *PostgresSessionRepository) RevokeUserSessions(userID, except uuid.UUID) error {
+	query := `UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND id <> $3 AND revoked_at IS NULL`
+	_, err := r.DB.Exec(query, time.Now(), userID, except)
+	if err != nil {
+		logger.Error("Error revoking sessions of user ", userID, ": ", err)
+	}
+	return err
+}
+
+func (r *PostgresSessionRepository) ListUserSessions(userID uuid.UUID) ([]*models.Session, error) {
+	query := `
+		SELECT id, user_id, client_id, scope, dpop_jkt, created_at, expires_at, revoked_at
+		FROM sessions
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+	rows, err := r.DB.Query(query, userID)
+	if err != nil {
+		logger.Error("Error listing sessions of user ", userID, ": ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+	for rows.Next() {
+		session := &models.Session{}
+		if err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.ClientID,
+			&session.Scope,
+			&session.DPoPJKT,
+			&session.CreatedAt,
+			&session.ExpiresAt,
+			&session.RevokedAt,
+		); err != nil {
+			logger.Error("Error scanning session: ", err)
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteExpiredSessions removes sessions past their expiry, revoked or not,
+// along with their refresh tokens.
+func (r *PostgresSessionRepository) DeleteExpiredSessions(before time.Time) (int64, error) {
+	query := `DELETE FROM sessions WHERE expires_at <= $1`
+	res, err := r.DB.Exec(query, before)
+	if err != nil {
+		logger.Error("Error deleting expired sessions: ", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
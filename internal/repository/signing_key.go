@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"authforge/internal/logger"
+	"authforge/internal/models"
+)
+
+type SigningKeyRepository interface {
+	CreateKey(key *models.SigningKey) error
+	ListKeys() ([]*models.SigningKey, error)
+	ActivateKey(id string) (bool, error)
+	RetireKey(id string) (bool, error)
+	PurgeRetiredKeys() (int64, error)
+}
+
+type PostgresSigningKeyRepository struct {
+	DB *sql.DB
+}
+
+func NewSigningKeyRepository(db *sql.DB) SigningKeyRepository {
+	return &PostgresSigningKeyRepository{DB: db}
+}
+
+func (r *PostgresSigningKeyRepository) CreateKey(key *models.SigningKey) error {
+	query := `
+		INSERT INTO signing_keys (id, algorithm, private_key, status, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	key.CreatedAt = time.Now()
+	key.Status = models.SigningKeyPending
+	_, err := r.DB.Exec(query, key.ID, key.Algorithm, key.PrivateKey, key.Status, key.CreatedAt)
+	if err != nil {
+		logger.Error("Error creating signing key ", key.ID, ": ", err)
+	}
+	return err
+}
+
+func (r *PostgresSigningKeyRepository) ListKeys() ([]*models.SigningKey, error) {
+	query := `
+		SELECT id, algorithm, private_key, status, created_at, activated_at, retired_at
+		FROM signing_keys
+		ORDER BY created_at
+	`
+	rows, err := r.DB.Query(query)
+	if err != nil {
+		logger.Error("Error listing signing keys: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*models.SigningKey
+	for rows.Next() {
+		key := &models.SigningKey{}
+		if err := rows.Scan(
+			&key.ID,
+			&key.Algorithm,
+			&key.PrivateKey,
+			&key.Status,
+			&key.CreatedAt,
+			&key.ActivatedAt,
+			&key.RetiredAt,
+		); err != nil {
+			logger.Error("Error scanning signing key: ", err)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// ActivateKey makes the key the only active one, demoting the previous active
+// key to inactive. It reports false when the key does not exist or is retired.
+func (r *PostgresSigningKeyRepository) ActivateKey(id string) (bool, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		logger.Error("Error starting key activation: ", err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	demote := `UPDATE signing_keys SET status = $1 WHERE status = $2 AND id <> $3`
+	if _, err := tx.Exec(demote, models.SigningKeyInactive, models.SigningKeyActive, id); err != nil {
+		logger.Error("Error demoting active signing key: ", err)
+		return false, err
+	}
+
+	activate := `
+		UPDATE signing_keys SET status = $1, activated_at = $2
+		WHERE id = $3 AND status IN ($4, $5)
+	`
+	res, err := tx.Exec(activate, models.SigningKeyActive, time.Now(), id, models.SigningKeyPending, models.SigningKeyInactive)
+	if err != nil {
+		logger.Error("Error activating signing key ", id, ": ", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading activated signing key count: ", err)
+		return false, err
+	}
+	if n != 1 {
+		return false, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("Error committing key activation: ", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// RetireKey reports false for unknown, already retired or active keys; the
+// active key has to be rotated away first.
+func (r *PostgresSigningKeyRepository) RetireKey(id string) (bool, error) {
+	query := `
+		UPDATE signing_keys SET status = $1, retired_at = $2
+		WHERE id = $3 AND status IN ($4, $5)
+	`
+	res, err := r.DB.Exec(query, models.SigningKeyRetired, time.Now(), id, models.SigningKeyPending, models.SigningKeyInactive)
+	if err != nil {
+		logger.Error("Error retiring signing key ", id, ": ", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading retired signing key count: ", err)
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (r *PostgresSigningKeyRepository) PurgeRetiredKeys() (int64, error) {
+	query := `DELETE FROM signing_keys WHERE status = $1`
+	res, err := r.DB.Exec(query, models.SigningKeyRetired)
+	if err != nil {
+		logger.Error("Error purging retired signing keys: ", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -3,6 +3,8 @@ package repository
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"authforge/internal/logger"
@@ -16,6 +18,13 @@ type UserRepository interface {
 	GetUserByEmail(email string) (*models.User, error)
 	GetUserByID(id uuid.UUID) (*models.User, error)
 	UpdateUser(user *models.User) error
+	IncrementTokenVersion(id uuid.UUID) error
+	UpdateProfile(user *models.User) error
+	ScheduleDeletion(id uuid.UUID, at time.Time) error
+	CancelDeletion(id uuid.UUID) (bool, error)
+	DeleteScheduledUsers(before time.Time) ([]uuid.UUID, error)
+	ListUsers(filter *models.UserFilter) ([]*models.User, error)
+	CountUsers(filter *models.UserFilter) (int, error)
 }
 
 type PostgresUserRepository struct {
@@ -57,12 +66,11 @@ func (r *PostgresUserRepository) CreateUser(user *models.User) error {
 	return err
 }
 
-func (r *PostgresUserRepository) GetUserByEmail(email string) (*models.User, error) {
-	query := `
-		SELECT id, email, password_hash, is_active, role, created_at, updated_at, failed_login_attempts, last_failed_login
-		FROM users WHERE email = $1`
+const userColumns = `id, email, password_hash, is_active, role, created_at, updated_at, failed_login_attempts, last_failed_login, token_version, display_name, locale, deletion_scheduled_at, email_verified`
+
+func scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
 	user := &models.User{}
-	err := r.DB.QueryRow(query, email).Scan(
+	err := row.Scan(
 		&user.ID,
 		&user.Email,
 		&user.PasswordHash,
@@ -72,7 +80,18 @@ func (r *PostgresUserRepository) GetUserByEmail(email string) (*models.User, err
 		&user.UpdatedAt,
 		&user.FailedLoginAttempts,
 		&user.LastFailedLogin,
+		&user.TokenVersion,
+		&user.DisplayName,
+		&user.Locale,
+		&user.DeletionScheduledAt,
+		&user.EmailVerified,
 	)
+	return user, err
+}
+
+func (r *PostgresUserRepository) GetUserByEmail(email string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
+	user, err := scanUser(r.DB.QueryRow(query, email))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			logger.Error("User not found with email ", email)
@@ -85,21 +104,8 @@ func (r *PostgresUserRepository) GetUserByEmail(email string) (*models.User, err
 }
 
 func (r *PostgresUserRepository) GetUserByID(id uuid.UUID) (*models.User, error) {
-	query := `
-		SELECT id, email, password_hash, is_active, role, created_at, updated_at, failed_login_attempts, last_failed_login
-		FROM users WHERE id = $1`
-	user := &models.User{}
-	err := r.DB.QueryRow(query, id).Scan(
-		&user.ID,
-		&user.Email,
-		&user.PasswordHash,
-		&user.IsActive,
-		&user.Role,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-		&user.FailedLoginAttempts,
-		&user.LastFailedLogin,
-	)
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	user, err := scanUser(r.DB.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			logger.Error("User not found with ID ", id)
@@ -114,8 +120,9 @@ func (r *PostgresUserRepository) GetUserByID(id uuid.UUID) (*models.User, error)
 func (r *PostgresUserRepository) UpdateUser(user *models.User) error {
 	query := `
 		UPDATE users 
-		SET email = $1, password_hash = $2, is_active = $3, role = $4, updated_at = $5, failed_login_attempts = $6, last_failed_login = $7
-		WHERE id = $8`
+		SET email = $1, password_hash = $2, is_active = $3, role = $4, updated_at = $5, failed_login_attempts = $6, last_failed_login = $7,
+			email_verified = $8
+		WHERE id = $9`
 	user.UpdatedAt = time.Now()
 	_, err := r.DB.Exec(query,
 		user.Email,
@@ -125,6 +132,7 @@ func (r *PostgresUserRepository) UpdateUser(user *models.User) error {
 		user.UpdatedAt,
 		user.FailedLoginAttempts,
 		user.LastFailedLogin,
+		user.EmailVerified,
 		user.ID,
 	)
 	if err != nil {
@@ -132,3 +140,147 @@ func (r *PostgresUserRepository) UpdateUser(user *models.User) error {
 	}
 	return err
 }
+
+func (r *PostgresUserRepository) IncrementTokenVersion(id uuid.UUID) error {
+	query := `UPDATE users SET token_version = token_version + 1 WHERE id = $1`
+	_, err := r.DB.Exec(query, id)
+	if err != nil {
+		logger.Error("Error incrementing token version for user ", id, ": ", err)
+	}
+	return err
+}
+
+func (r *PostgresUserRepository) UpdateProfile(user *models.User) error {
+	query := `UPDATE users SET display_name = $1, locale = $2, updated_at = $3 WHERE id = $4`
+	user.UpdatedAt = time.Now()
+	_, err := r.DB.Exec(query, user.DisplayName, user.Locale, user.UpdatedAt, user.ID)
+	if err != nil {
+		logger.Error("Error updating profile of user ", user.ID, ": ", err)
+	}
+	return err
+}
+
+func (r *PostgresUserRepository) ScheduleDeletion(id uuid.UUID, at time.Time) error {
+	query := `UPDATE users SET deletion_scheduled_at = $1 WHERE id = $2`
+	_, err := r.DB.Exec(query, at, id)
+	if err != nil {
+		logger.Error("Error scheduling deletion of user ", id, ": ", err)
+	}
+	return err
+}
+
+// CancelDeletion reports false when no deletion was scheduled.
+func (r *PostgresUserRepository) CancelDeletion(id uuid.UUID) (bool, error) {
+	query := `UPDATE users SET deletion_scheduled_at = NULL WHERE id = $1 AND deletion_scheduled_at IS NOT NULL`
+	res, err := r.DB.Exec(query, id)
+	if err != nil {
+		logger.Error("Error cancelling deletion of user ", id, ": ", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		logger.Error("Error reading cancelled deletion count: ", err)
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// DeleteScheduledUsers removes users whose deletion is due. Rows referencing
+// them are removed by ON DELETE CASCADE, audit events are kept anonymized.
+func (r *PostgresUserRepository) DeleteScheduledUsers(before time.Time) ([]uuid.UUID, error) {
+	query := `DELETE FROM users WHERE deletion_scheduled_at <= $1 RETURNING id`
+	rows, err := r.DB.Query(query, before)
+	if err != nil {
+		logger.Error("Error deleting scheduled users: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			logger.Error("Error scanning deleted user: ", err)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// userFilterClause builds the WHERE clause for filter along with its
+// arguments.
+func userFilterClause(filter *models.UserFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Role != nil {
+		add("role = $%d", *filter.Role)
+	}
+	if filter.IsActive != nil {
+		add("is_active = $%d", *filter.IsActive)
+	}
+	if filter.CreatedAfter != nil {
+		add("created_at >= $%d", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		add("created_at < $%d", *filter.CreatedBefore)
+	}
+	if filter.Email != "" {
+		add("email ILIKE '%%' || $%d || '%%'", likeEscaper.Replace(filter.Email))
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// listUsersQuery builds the query for one page of users matching filter,
+// newest first.
+func listUsersQuery(filter *models.UserFilter) (string, []interface{}) {
+	where, args := userFilterClause(filter)
+	args = append(args, filter.Limit, filter.Offset)
+	query := `SELECT ` + userColumns + ` FROM users` + where +
+		fmt.Sprintf(` ORDER BY created_at DESC, id LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+	return query, args
+}
+
+func (r *PostgresUserRepository) ListUsers(filter *models.UserFilter) ([]*models.User, error) {
+	query, args := listUsersQuery(filter)
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		logger.Error("Error listing users: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			logger.Error("Error scanning user: ", err)
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r *PostgresUserRepository) CountUsers(filter *models.UserFilter) (int, error) {
+	where, args := userFilterClause(filter)
+	query := `SELECT COUNT(*) FROM users` + where
+
+	var n int
+	if err := r.DB.QueryRow(query, args...).Scan(&n); err != nil {
+		logger.Error("Error counting users: ", err)
+		return 0, err
+	}
+	return n, nil
+}
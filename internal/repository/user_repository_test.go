@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"authforge/internal/models"
+)
+
+func TestUserFilterClause(t *testing.T) {
+	admin := models.RoleAdmin
+	active := false
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		filter    *models.UserFilter
+		wantWhere string
+		wantArgs  []interface{}
+	}{
+		{name: "no filter", filter: &models.UserFilter{}},
+		{
+			name:      "role",
+			filter:    &models.UserFilter{Role: &admin},
+			wantWhere: " WHERE role = $1",
+			wantArgs:  []interface{}{models.RoleAdmin},
+		},
+		{
+			name:      "all fields",
+			filter:    &models.UserFilter{Role: &admin, IsActive: &active, CreatedAfter: &after, CreatedBefore: &before, Email: "example"},
+			wantWhere: " WHERE role = $1 AND is_active = $2 AND created_at >= $3 AND created_at < $4 AND email ILIKE '%' || $5 || '%'",
+			wantArgs:  []interface{}{models.RoleAdmin, false, after, before, "example"},
+		},
+		{
+			name:      "email wildcards are matched literally",
+			filter:    &models.UserFilter{Email: `50%_off\`},
+			wantWhere: " WHERE email ILIKE '%' || $1 || '%'",
+			wantArgs:  []interface{}{`50\%\_off\\`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := userFilterClause(tt.filter)
+			if where != tt.wantWhere {
+				t.Fatalf("where = %q, want %q", where, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Fatalf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestListUsersQuery(t *testing.T) {
+	admin := models.RoleAdmin
+
+	tests := []struct {
+		name       string
+		filter     *models.UserFilter
+		wantSuffix string
+		wantArgs   []interface{}
+	}{
+		{
+			name:       "no filter",
+			filter:     &models.UserFilter{Limit: 20},
+			wantSuffix: " FROM users ORDER BY created_at DESC, id LIMIT $1 OFFSET $2",
+			wantArgs:   []interface{}{20, 0},
+		},
+		{
+			name:       "page after filter arguments",
+			filter:     &models.UserFilter{Role: &admin, Email: "a", Limit: 10, Offset: 30},
+			wantSuffix: " FROM users WHERE role = $1 AND email ILIKE '%' || $2 || '%' ORDER BY created_at DESC, id LIMIT $3 OFFSET $4",
+			wantArgs:   []interface{}{models.RoleAdmin, "a", 10, 30},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := listUsersQuery(tt.filter)
+			if !strings.HasSuffix(query, tt.wantSuffix) {
+				t.Fatalf("query = %q, want it to end with %q", query, tt.wantSuffix)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Fatalf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+package services
+
+import (
+	"errors"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"authforge/config"
+	"authforge/internal/logger"
+	"authforge/internal/mailer"
+	"authforge/internal/models"
+	"authforge/internal/repository"
+)
+
+const (
+	maxDisplayNameLength = 100
+
+	emailChangeExpiry = 24 * time.Hour
+	emailRevertWindow = 7 * 24 * time.Hour
+)
+
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// AccountService covers what signed-in users can do with their own account.
+type AccountService interface {
+	GetProfile(userID uuid.UUID) (*models.User, error)
+	UpdateProfile(userID uuid.UUID, update *ProfileUpdate) (*models.User, error)
+	ChangePassword(userID, sessionID uuid.UUID, currentPassword, newPassword string, signOutOthers bool) error
+	RequestEmailChange(userID uuid.UUID, newEmail, password string) error
+	ConfirmEmailChange(token string) error
+	RevertEmailChange(token string) error
+	DeleteAccount(userID uuid.UUID, password string) (time.Time, error)
+	PurgeDeletedAccounts() (int, error)
+	ExportData(userID uuid.UUID) (*PersonalDataExport, error)
+	DownloadExport(id uuid.UUID, expires int64, signature string) (*models.DataExport, error)
+	PurgeExpiredExports() (int64, error)
+}
+
+type accountService struct {
+	userRepo               repository.UserRepository
+	passwordResetTokenRepo repository.PasswordResetTokenRepository
+	sessionRepo            repository.SessionRepository
+	emailChangeRepo        repository.EmailChangeTokenRepository
+	auditRepo              repository.AuditEventRepository
+	exportRepo             repository.DataExportRepository
+	mailer                 mailer.Mailer
+	cfg                    *config.Config
+	exportLinkSecret       []byte
+}
+
+// ProfileUpdate holds the editable profile fields; nil fields are left as
+// they are.
+type ProfileUpdate struct {
+	DisplayName *string `json:"displayName"`
+	Locale      *string `json:"locale"`
+}
+
+func NewAccountService(
+	userRepo repository.UserRepository,
+	passwordResetTokenRepo repository.PasswordResetTokenRepository,
+	sessionRepo repository.SessionRepository,
+	emailChangeRepo repository.EmailChangeTokenRepository,
+	auditRepo repository.AuditEventRepository,
+	exportRepo repository.DataExportRepository,
+	m mailer.Mailer,
+	cfg *config.Config,
+) AccountService {
+	logger.Info("Initializing AccountService")
+	return &accountService{
+		userRepo:               userRepo,
+		passwordResetTokenRepo: passwordResetTokenRepo,
+		sessionRepo:            sessionRepo,
+		emailChangeRepo:        emailChangeRepo,
+		auditRepo:              auditRepo,
+		exportRepo:             exportRepo,
+		mailer:                 m,
+		cfg:                    cfg,
+		exportLinkSecret:       []byte(cfg.ExportLinkSecret),
+	}
+}
+
+func (s *accountService) GetProfile(userID uuid.UUID) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		logger.Error("Error retrieving profile of user ", userID, ": ", err)
+		return nil, errors.New("user not found")
+	}
+	return user, nil
+}
+
+func (s *accountService) UpdateProfile(userID uuid.UUID, update *ProfileUpdate) (*models.User, error) {
+	user, err := s.GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.DisplayName != nil {
+		name := strings.TrimSpace(*update.DisplayName)
+		if utf8.RuneCountInString(name) > maxDisplayNameLength {
+			return nil, errors.New("display name is too long")
+		}
+		user.DisplayName = name
+	}
+
+	if update.Locale != nil {
+		locale := strings.TrimSpace(*update.Locale)
+		if locale != "" && !localePattern.MatchString(locale) {
+			return nil, errors.New("invalid locale")
+		}
+		user.Locale = locale
+	}
+
+	if err := s.userRepo.UpdateProfile(user); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Profile updated for user ", userID)
+	return user, nil
+}
+
+// ChangePassword leaves the caller's own session alive; with signOutOthers
+// every other session of the user is revoked.
+func (s *accountService) ChangePassword(userID, sessionID uuid.UUID, currentPassword, newPassword string, signOutOthers bool) error {
+	user, err := s.GetProfile(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
+		logger.Error("Password change failed, wrong current password for ", user.Email)
+		return errors.New("invalid current password")
+	}
+
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		logger.Error("Error hashing new password for user ", user.Email, ": ", err)
+		return err
+	}
+	user.PasswordHash = hashedPassword
+
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		logger.Error("Error updating password for user ", user.Email, ": ", err)
+		return err
+	}
+
+	if err := s.passwordResetTokenRepo.InvalidateUserTokens(user.ID); err != nil {
+		return err
+	}
+
+	if signOutOthers {
+		if err := s.sessionRepo.RevokeUserSessions(user.ID, sessionID); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Password changed for user ", user.Email)
+	return nil
+}
+
+// RequestEmailChange mails a confirmation link to the new address. The
+// account keeps its current email until the link is followed.
+func (s *accountService) RequestEmailChange(userID uuid.UUID, newEmail, password string) error {
+	newEmail = strings.TrimSpace(newEmail)
+	if addr, err := mail.ParseAddress(newEmail); err != nil || addr.Address != newEmail {
+		return errors.New("invalid email")
+	}
+
+	user, err := s.GetProfile(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		logger.Error("Email change failed, wrong password for ", user.Email)
+		return errors.New("invalid password")
+	}
+
+	if strings.EqualFold(newEmail, user.Email) {
+		return errors.New("new email is the same as the current one")
+	}
+	if existing, err := s.userRepo.GetUserByEmail(newEmail); err == nil && existing != nil {
+		logger.Error("Email change failed, address already in use: ", newEmail)
+		return errors.New("email already in use")
+	}
+
+	// Only the most recent request can be confirmed.
+	if err := s.emailChangeRepo.DeletePendingTokens(user.ID); err != nil {
+		return err
+	}
+
+	confirmationToken, err := generateRandomToken(32)
+	if err != nil {
+		logger.Error("Error generating email change token: ", err)
+		return err
+	}
+
+	token := &models.EmailChangeToken{
+		UserID:    user.ID,
+		OldEmail:  user.Email,
+		NewEmail:  newEmail,
+		Token:     confirmationToken,
+		ExpiresAt: time.Now().Add(emailChangeExpiry),
+	}
+	if err := s.emailChangeRepo.CreateToken(token); err != nil {
+		return err
+	}
+
+	if err := s.mailer.SendEmailChangeConfirmation(newEmail, confirmationToken); err != nil {
+		logger.Error("Error sending email change confirmation to ", newEmail, ": ", err)
+		return err
+	}
+
+	logger.Info("Email change requested for user ", user.ID)
+	return nil
+}
+
+// ConfirmEmailChange swaps in the new address and sends the old one a link
+// to undo the change.
+func (s *accountService) ConfirmEmailChange(token string) error {
+	change, err := s.emailChangeRepo.GetByToken(token)
+	if err != nil || change.ConfirmedAt != nil || time.Now().After(change.ExpiresAt) {
+		logger.Error("Email change confirmation failed, invalid or expired token")
+		return errors.New("invalid or expired token")
+	}
+
+	user, err := s.GetProfile(change.UserID)
+	if err != nil {
+		return err
+	}
+	if user.Email != change.OldEmail {
+		logger.Error("Email change confirmation failed, email of user ", user.ID, " changed meanwhile")
+		return errors.New("invalid or expired token")
+	}
+	if existing, err := s.userRepo.GetUserByEmail(change.NewEmail); err == nil && existing != nil {
+		logger.Error("Email change confirmation failed, address already in use: ", change.NewEmail)
+		return errors.New("email already in use")
+	}
+
+	revertToken, err := generateRandomToken(32)
+	if err != nil {
+		logger.Error("Error generating email revert token: ", err)
+		return err
+	}
+
+	confirmed, err := s.emailChangeRepo.MarkConfirmed(change.ID, revertToken)
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return errors.New("invalid or expired token")
+	}
+
+	user.Email = change.NewEmail
+	user.EmailVerified = true
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		logger.Error("Error updating email of user ", user.ID, ": ", err)
+		return err
+	}
+	logger.Info("Email changed for user ", user.ID)
+
+	// The change already happened, so a failed notice is only logged.
+	if err := s.mailer.SendEmailChangedNotice(change.OldEmail, change.NewEmail, revertToken); err != nil {
+		logger.Error("Error sending email change notice to ", change.OldEmail, ": ", err)
+	}
+	return nil
+}
+
+// RevertEmailChange restores the previous address. Since the change may not
+// have been made by the owner, every session is ended and outstanding reset
+// links, which may have gone to the new address, stop working.
+func (s *accountService) RevertEmailChange(token string) error {
+	change, err := s.emailChangeRepo.GetByRevertToken(token)
+	if err != nil || change.ConfirmedAt == nil || change.RevertedAt != nil ||
+		time.Now().After(change.ConfirmedAt.Add(emailRevertWindow)) {
+		logger.Error("Email change revert failed, invalid or expired token")
+		return errors.New("invalid or expired token")
+	}
+
+	user, err := s.GetProfile(change.UserID)
+	if err != nil {
+		return err
+	}
+	if existing, err := s.userRepo.GetUserByEmail(change.OldEmail); err == nil && existing.ID != user.ID {
+		logger.Error("Email change revert failed, address taken by another user: ", change.OldEmail)
+		return errors.New("email already in use")
+	}
+
+	reverted, err := s.emailChangeRepo.MarkReverted(change.ID)
+	if err != nil {
+		return err
+	}
+	if !reverted {
+		return errors.New("invalid or expired token")
+	}
+
+	// The revert link was mailed to the old address, which proves it again.
+	user.Email = change.OldEmail
+	user.EmailVerified = true
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		logger.Error("Error restoring email of user ", user.ID, ": ", err)
+		return err
+	}
+
+	if err := s.emailChangeRepo.DeletePendingTokens(user.ID); err != nil {
+		return err
+	}
+	if err := s.passwordResetTokenRepo.InvalidateUserTokens(user.ID); err != nil {
+		return err
+	}
+	if err := s.sessionRepo.RevokeUserSessions(user.ID, uuid.Nil); err != nil {
+		return err
+	}
+	if err := s.userRepo.IncrementTokenVersion(user.ID); err != nil {
+		logger.Error("Error revoking all tokens for user ", user.ID, ": ", err)
+		return err
+	}
+
+	logger.Info("Email change reverted for user ", user.ID)
+	return nil
+}
+
+// DeleteAccount signs the user out everywhere and schedules the account for
+// deletion once the grace period is over. Signing in again cancels it.
+func (s *accountService) DeleteAccount(userID uuid.UUID, password string) (time.Time, error) {
+	user, err := s.GetProfile(userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		logger.Error("Account deletion failed, wrong password for ", user.Email)
+		return time.Time{}, errors.New("invalid password")
+	}
+
+	deleteAt := time.Now().Add(s.cfg.AccountDeletionGrace)
+	if err := s.userRepo.ScheduleDeletion(user.ID, deleteAt); err != nil {
+		return time.Time{}, err
+	}
+
+	if err := s.sessionRepo.RevokeUserSessions(user.ID, uuid.Nil); err != nil {
+		return time.Time{}, err
+	}
+	if err := s.userRepo.IncrementTokenVersion(user.ID); err != nil {
+		logger.Error("Error revoking all tokens for user ", user.ID, ": ", err)
+		return time.Time{}, err
+	}
+
+	if err := s.auditRepo.RecordEvent(&models.AuditEvent{
+		UserID: &user.ID,
+		Event:  models.AuditAccountDeletionScheduled,
+	}); err != nil {
+		return time.Time{}, err
+	}
+
+	logger.Info("Account deletion scheduled for user ", user.ID, " at ", deleteAt)
+	return deleteAt, nil
+}
+
+// PurgeDeletedAccounts deletes the accounts whose grace period is over and
+// returns how many were removed.
+func (s *accountService) PurgeDeletedAccounts() (int, error) {
+	ids, err := s.userRepo.DeleteScheduledUsers(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		logger.Info("Deleted account of user ", id)
+		if err := s.auditRepo.RecordEvent(&models.AuditEvent{Event: models.AuditAccountDeleted}); err != nil {
+			return len(ids), err
+		}
+	}
+	return len(ids), nil
+}
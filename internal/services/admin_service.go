@@ -0,0 +1,158 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+
+	"authforge/internal/logger"
+	"authforge/internal/models"
+	"authforge/internal/repository"
+)
+
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+)
+
+// AdminService lets administrators manage other users' accounts.
+type AdminService interface {
+	ListUsers(filter *models.UserFilter, page, pageSize int) (*UserPage, error)
+	GetUser(id uuid.UUID) (*models.User, error)
+	UpdateUser(adminID, id uuid.UUID, update *AdminUserUpdate) (*models.User, error)
+	ForceLogout(id uuid.UUID) error
+}
+
+type adminService struct {
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+}
+
+type UserPage struct {
+	Users    []*models.User `json:"users"`
+	Total    int            `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+}
+
+// AdminUserUpdate holds the account fields an administrator can change; nil
+// fields are left as they are.
+type AdminUserUpdate struct {
+	IsActive *bool            `json:"isActive"`
+	Role     *models.UserRole `json:"role"`
+}
+
+func NewAdminService(userRepo repository.UserRepository, sessionRepo repository.SessionRepository) AdminService {
+	logger.Info("Initializing AdminService")
+	return &adminService{
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+	}
+}
+
+func (s *adminService) ListUsers(filter *models.UserFilter, page, pageSize int) (*UserPage, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = defaultUserPageSize
+	}
+	if pageSize > maxUserPageSize {
+		pageSize = maxUserPageSize
+	}
+	filter.Limit = pageSize
+	filter.Offset = (page - 1) * pageSize
+
+	total, err := s.userRepo.CountUsers(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := s.userRepo.ListUsers(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserPage{
+		Users:    users,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+func (s *adminService) GetUser(id uuid.UUID) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(id)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	return user, nil
+}
+
+// UpdateUser changes a user's role or activation status. Changing the role
+// invalidates the user's tokens; deactivating also ends all sessions.
+// Administrators cannot change their own account so they cannot lock
+// themselves out.
+func (s *adminService) UpdateUser(adminID, id uuid.UUID, update *AdminUserUpdate) (*models.User, error) {
+	if adminID == id && (update.IsActive != nil || update.Role != nil) {
+		return nil, errors.New("cannot change your own role or status")
+	}
+
+	user, err := s.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	roleChanged := false
+	if update.Role != nil {
+		if *update.Role != models.RoleUser && *update.Role != models.RoleAdmin {
+			return nil, errors.New("invalid role")
+		}
+		roleChanged = user.Role != *update.Role
+		user.Role = *update.Role
+	}
+
+	deactivated := false
+	if update.IsActive != nil {
+		deactivated = user.IsActive && !*update.IsActive
+		user.IsActive = *update.IsActive
+	}
+
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		logger.Error("Error updating user ", id, " as admin ", adminID, ": ", err)
+		return nil, err
+	}
+	logger.Info("Admin ", adminID, " updated user ", id)
+
+	// Tokens carry the role, so the ones issued under the old role must stop
+	// validating.
+	if roleChanged {
+		if err := s.userRepo.IncrementTokenVersion(id); err != nil {
+			logger.Error("Error revoking tokens of user ", id, " after a role change: ", err)
+			return nil, err
+		}
+	}
+	if deactivated {
+		if err := s.ForceLogout(id); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+func (s *adminService) ForceLogout(id uuid.UUID) error {
+	if _, err := s.GetUser(id); err != nil {
+		return err
+	}
+
+	if err := s.sessionRepo.RevokeUserSessions(id, uuid.Nil); err != nil {
+		return err
+	}
+	if err := s.userRepo.IncrementTokenVersion(id); err != nil {
+		logger.Error("Error revoking all tokens for user ", id, ": ", err)
+		return err
+	}
+
+	logger.Info("All sessions of user ", id, " revoked by admin")
+	return nil
+}
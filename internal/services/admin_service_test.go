@@ -0,0 +1,108 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"authforge/internal/models"
+)
+
+func TestAdminUpdateUser(t *testing.T) {
+	admin := models.RoleAdmin
+	user := models.RoleUser
+	owner := models.UserRole("owner")
+	active := true
+	inactive := false
+
+	tests := []struct {
+		name            string
+		self            bool
+		update          *AdminUserUpdate
+		wantErr         bool
+		wantRole        models.UserRole
+		wantVersionBump bool
+		wantRevoked     bool
+	}{
+		{name: "promote to admin", update: &AdminUserUpdate{Role: &admin}, wantRole: models.RoleAdmin, wantVersionBump: true},
+		{name: "unchanged role", update: &AdminUserUpdate{Role: &user}, wantRole: models.RoleUser},
+		{name: "reactivate", update: &AdminUserUpdate{IsActive: &active}, wantRole: models.RoleUser},
+		{name: "deactivate", update: &AdminUserUpdate{IsActive: &inactive}, wantRole: models.RoleUser, wantVersionBump: true, wantRevoked: true},
+		{name: "unknown role", update: &AdminUserUpdate{Role: &owner}, wantErr: true},
+		{name: "own role", self: true, update: &AdminUserUpdate{Role: &user}, wantErr: true},
+		{name: "own status", self: true, update: &AdminUserUpdate{IsActive: &inactive}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &fakeUserRepo{users: make(map[uuid.UUID]*models.User)}
+			sessions := &fakeSessionRepo{sessions: make(map[uuid.UUID]*models.Session)}
+			target := &models.User{ID: uuid.New(), Email: "user@example.com", IsActive: true, Role: models.RoleUser, TokenVersion: 1}
+			users.users[target.ID] = target
+			session := &models.Session{ID: uuid.New(), UserID: target.ID, ExpiresAt: time.Now().Add(time.Hour)}
+			sessions.sessions[session.ID] = session
+
+			adminID := uuid.New()
+			if tt.self {
+				adminID = target.ID
+			}
+			updated, err := NewAdminService(users, sessions).UpdateUser(adminID, target.ID, tt.update)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("update accepted, want an error")
+				}
+				if target.Role != models.RoleUser || !target.IsActive || target.TokenVersion != 1 {
+					t.Fatalf("rejected update changed the user: %+v", target)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("update failed: %v", err)
+			}
+
+			if updated.Role != tt.wantRole {
+				t.Fatalf("role = %q, want %q", updated.Role, tt.wantRole)
+			}
+			if bumped := users.users[target.ID].TokenVersion > 1; bumped != tt.wantVersionBump {
+				t.Fatalf("token version bumped = %v, want %v", bumped, tt.wantVersionBump)
+			}
+			if revoked := session.RevokedAt != nil; revoked != tt.wantRevoked {
+				t.Fatalf("session revoked = %v, want %v", revoked, tt.wantRevoked)
+			}
+		})
+	}
+}
+
+func TestAdminListUsersPagination(t *testing.T) {
+	tests := []struct {
+		name         string
+		page         int
+		pageSize     int
+		wantPage     int
+		wantPageSize int
+		wantOffset   int
+	}{
+		{name: "defaults", wantPage: 1, wantPageSize: defaultUserPageSize},
+		{name: "third page", page: 3, pageSize: 10, wantPage: 3, wantPageSize: 10, wantOffset: 20},
+		{name: "page size capped", page: 2, pageSize: 1000, wantPage: 2, wantPageSize: maxUserPageSize, wantOffset: maxUserPageSize},
+		{name: "negative page", page: -1, pageSize: 5, wantPage: 1, wantPageSize: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &fakeUserRepo{users: make(map[uuid.UUID]*models.User)}
+			filter := &models.UserFilter{}
+			page, err := NewAdminService(users, nil).ListUsers(filter, tt.page, tt.pageSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.Page != tt.wantPage || page.PageSize != tt.wantPageSize {
+				t.Fatalf("page %d of size %d, want %d of size %d", page.Page, page.PageSize, tt.wantPage, tt.wantPageSize)
+			}
+			if filter.Limit != tt.wantPageSize || filter.Offset != tt.wantOffset {
+				t.Fatalf("limit %d offset %d, want %d %d", filter.Limit, filter.Offset, tt.wantPageSize, tt.wantOffset)
+			}
+		})
+	}
+}
@@ -2,8 +2,13 @@ package services
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -11,38 +16,81 @@ import (
 	"golang.org/x/crypto/bcrypt"
 
 	"authforge/config"
+	"authforge/internal/dpop"
+	"authforge/internal/keyring"
 	"authforge/internal/logger"
 	"authforge/internal/mailer"
 	"authforge/internal/models"
 	"authforge/internal/repository"
+	"authforge/internal/tokenformat"
 )
 
 type AuthService interface {
 	RegisterUser(user *models.User, password string) error
-	Login(email, password string) (*TokenPair, error)
+	Login(email, password, clientID string, proof *DPoPProof) (*TokenPair, error)
+	Authenticate(email, password string) (*models.User, error)
+	IssueTokens(user *models.User, clientID, scope, nonce string) (*TokenPair, error)
+	IssueClientToken(client *models.OAuthClient, scope string) (*TokenPair, error)
+	IssueDelegatedToken(subject *models.CustomClaims, actor *models.OAuthClient, scope string, audience []string) (*TokenPair, error)
+	Refresh(refreshToken string, client *models.OAuthClient, proof *DPoPProof) (*TokenPair, error)
+	Logout(accessToken string, proof *DPoPProof) error
+	LogoutAll(accessToken string, proof *DPoPProof) error
 	ConfirmAccount(tokenString string) error
 	RequestPasswordReset(email string) error
 	ResetPassword(token, newPassword string) error
 	ValidateToken(tokenString string) (*models.CustomClaims, error)
+	ValidateDPoPToken(tokenString string, proof *DPoPProof) (*models.CustomClaims, error)
+	ValidateTokenForAudience(tokenString, audience string, proof *DPoPProof) (*models.CustomClaims, error)
+	IntrospectToken(tokenString, tokenTypeHint string) (*models.CustomClaims, error)
+	RevokeToken(tokenString, tokenTypeHint string, client *models.OAuthClient) error
+	PurgeExpiredTokens() (int64, error)
+	GetUserByID(id uuid.UUID) (*models.User, error)
+	RegisterClaimsProvider(provider ClaimsProvider)
+	DPoPNonce() string
 }
 
 type authService struct {
 	userRepo               repository.UserRepository
 	tokenRepo              repository.ConfirmationTokenRepository
 	passwordResetTokenRepo repository.PasswordResetTokenRepository
+	refreshTokenRepo       repository.RefreshTokenRepository
+	sessionRepo            repository.SessionRepository
+	revokedTokenRepo       repository.RevokedTokenRepository
+	opaqueTokenRepo        repository.OpaqueTokenRepository
+	clientRepo             repository.OAuthClientRepository
+	auditRepo              repository.AuditEventRepository
+	keys                   *keyring.Keyring
+	format                 tokenformat.Format
+	dpop                   *dpop.Verifier
 	cfg                    *config.Config
 	mailer                 mailer.Mailer
+	claimsProviders        []ClaimsProvider
 }
 
 type TokenPair struct {
 	AccessToken  string `json:"accessToken"`
 	RefreshToken string `json:"refreshToken"`
+	IDToken      string `json:"idToken,omitempty"`
+	ExpiresIn    int64  `json:"expiresIn"`
+	Scope        string `json:"scope,omitempty"`
+	TokenType    string `json:"tokenType"`
+
+	IssuedTokenType string `json:"issuedTokenType,omitempty"`
 }
 
 func NewAuthService(
 	userRepo repository.UserRepository,
 	tokenRepo repository.ConfirmationTokenRepository,
 	passwordResetTokenRepo repository.PasswordResetTokenRepository,
+	refreshTokenRepo repository.RefreshTokenRepository,
+	sessionRepo repository.SessionRepository,
+	revokedTokenRepo repository.RevokedTokenRepository,
+	opaqueTokenRepo repository.OpaqueTokenRepository,
+	clientRepo repository.OAuthClientRepository,
+	auditRepo repository.AuditEventRepository,
+	keys *keyring.Keyring,
+	format tokenformat.Format,
+	dpopVerifier *dpop.Verifier,
 	cfg *config.Config,
 	m mailer.Mailer,
 ) AuthService {
@@ -51,6 +99,15 @@ func NewAuthService(
 		userRepo:               userRepo,
 		tokenRepo:              tokenRepo,
 		passwordResetTokenRepo: passwordResetTokenRepo,
+		refreshTokenRepo:       refreshTokenRepo,
+		sessionRepo:            sessionRepo,
+		revokedTokenRepo:       revokedTokenRepo,
+		opaqueTokenRepo:        opaqueTokenRepo,
+		clientRepo:             clientRepo,
+		auditRepo:              auditRepo,
+		keys:                   keys,
+		format:                 format,
+		dpop:                   dpopVerifier,
 		cfg:                    cfg,
 		mailer:                 m,
 	}
@@ -63,23 +120,18 @@ func (s *authService) RegisterUser(user *models.User, password string) error {
 		return errors.New("user already exists")
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(password)
 	if err != nil {
 		logger.Error("Error hashing password for ", user.Email, ": ", err)
 		return err
 	}
 
-	user.PasswordHash = string(hashedPassword)
+	user.PasswordHash = hashedPassword
 	user.IsActive = false
 
-	if user.Role == "" {
-		user.Role = "user"
-	}
-
-	if user.Role != models.RoleUser && user.Role != models.RoleAdmin {
-		logger.Error("Invalid role specified for user: ", user.Email)
-		return errors.New("invalid role")
-	}
+	// Self-registered accounts are always plain users; only administrators
+	// can grant the admin role.
+	user.Role = models.RoleUser
 
 	user.ID = uuid.New()
 
@@ -113,7 +165,27 @@ func (s *authService) RegisterUser(user *models.User, password string) error {
 	return nil
 }
 
-func (s *authService) Login(email, password string) (*TokenPair, error) {
+func (s *authService) Login(email, password, clientID string, proof *DPoPProof) (*TokenPair, error) {
+	if _, err := s.audienceFor(clientID); err != nil {
+		logger.Error("Login failed, unknown client: ", clientID)
+		return nil, err
+	}
+
+	jkt, err := s.verifyProof(proof, "")
+	if err != nil {
+		logger.Error("Login failed, invalid DPoP proof for ", email, ": ", err)
+		return nil, err
+	}
+
+	user, err := s.Authenticate(email, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startSession(user, clientID, "", "", jkt)
+}
+
+func (s *authService) Authenticate(email, password string) (*models.User, error) {
 	user, err := s.userRepo.GetUserByEmail(email)
 	if err != nil {
 		logger.Error("Login failed, user not found: ", email)
@@ -130,36 +202,533 @@ func (s *authService) Login(email, password string) (*TokenPair, error) {
 		return nil, errors.New("invalid credentials")
 	}
 
-	accessToken, err := s.generateJWTToken(user, s.cfg.JWTExpiry)
+	// Signing in during the grace period keeps the account.
+	if user.DeletionScheduledAt != nil {
+		if err := s.cancelDeletion(user); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (s *authService) cancelDeletion(user *models.User) error {
+	cancelled, err := s.userRepo.CancelDeletion(user.ID)
+	if err != nil {
+		return err
+	}
+	user.DeletionScheduledAt = nil
+	if !cancelled {
+		return nil
+	}
+
+	logger.Info("Account deletion cancelled for user ", user.ID)
+	if err := s.auditRepo.RecordEvent(&models.AuditEvent{
+		UserID: &user.ID,
+		Event:  models.AuditAccountDeletionCancelled,
+	}); err != nil {
+		logger.Error("Error recording cancelled deletion of user ", user.ID, ": ", err)
+	}
+	return nil
+}
+
+func (s *authService) IssueTokens(user *models.User, clientID, scope, nonce string) (*TokenPair, error) {
+	return s.startSession(user, clientID, scope, nonce, "")
+}
+
+func (s *authService) startSession(user *models.User, clientID, scope, nonce, jkt string) (*TokenPair, error) {
+	session := &models.Session{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		ClientID:  clientID,
+		Scope:     scope,
+		DPoPJKT:   jkt,
+		ExpiresAt: time.Now().Add(s.cfg.RefreshExpiry),
+	}
+	if err := s.sessionRepo.CreateSession(session); err != nil {
+		logger.Error("Error creating session for ", user.Email, ": ", err)
+		return nil, err
+	}
+
+	// A missing audit entry must not lock users out.
+	if err := s.auditRepo.RecordEvent(&models.AuditEvent{UserID: &user.ID, Event: models.AuditLogin}); err != nil {
+		logger.Error("Error recording login of user ", user.ID, ": ", err)
+	}
+
+	return s.issueTokenPair(user, session, nonce)
+}
+
+func (s *authService) IssueClientToken(client *models.OAuthClient, scope string) (*TokenPair, error) {
+	audience, err := s.audienceFor(client.ID)
 	if err != nil {
-		logger.Error("Error generating access token for ", email, ": ", err)
 		return nil, err
 	}
 
-	refreshToken, err := s.generateJWTToken(user, s.cfg.RefreshExpiry)
+	claims := &models.CustomClaims{
+		TokenUse: models.TokenUseAccess,
+		ClientID: client.ID,
+		Scope:    scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.Issuer,
+			Audience:  audience,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.cfg.ClientExpiry)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   client.ID,
+			ID:        uuid.NewString(),
+		},
+	}
+
+	accessToken, err := s.issueToken(claims)
 	if err != nil {
-		logger.Error("Error generating refresh token for ", email, ": ", err)
+		logger.Error("Error generating client token for ", client.ID, ": ", err)
 		return nil, err
 	}
+
 	return &TokenPair{
+		AccessToken: accessToken,
+		ExpiresIn:   int64(s.cfg.ClientExpiry.Seconds()),
+		Scope:       scope,
+		TokenType:   tokenTypeBearer,
+	}, nil
+}
+
+// IssueDelegatedToken mints a short-lived copy of the subject token for the
+// acting client, limited to the given scope and to audiences both the subject
+// token and the actor are allowed to reach. The user's role is not passed
+// on, so a delegated token never carries the subject's privileges.
+func (s *authService) IssueDelegatedToken(subject *models.CustomClaims, actor *models.OAuthClient, scope string, audience []string) (*TokenPair, error) {
+	allowed, err := s.audienceFor(actor.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(subject.Audience) > 0 {
+		allowed = slices.DeleteFunc(slices.Clone(allowed), func(aud string) bool {
+			return !slices.Contains(subject.Audience, aud)
+		})
+	}
+
+	if len(audience) == 0 {
+		audience = allowed
+	}
+	for _, aud := range audience {
+		if !slices.Contains(allowed, aud) {
+			return nil, newOAuthError("invalid_target", "audience "+aud+" is not allowed")
+		}
+	}
+	if len(audience) == 0 {
+		return nil, newOAuthError("invalid_target", "no audience available for this token")
+	}
+
+	expiresAt := time.Now().Add(s.cfg.ExchangeExpiry)
+	if subject.ExpiresAt.Time.Before(expiresAt) {
+		expiresAt = subject.ExpiresAt.Time
+	}
+
+	claims := &models.CustomClaims{
+		UserID:    subject.UserID,
+		TokenUse:  models.TokenUseAccess,
+		SessionID: subject.SessionID,
+		ClientID:  actor.ID,
+		Scope:     scope,
+		Version:   subject.Version,
+		Act:       &models.Actor{Subject: actor.ID, Act: subject.Act},
+		Extra:     subject.Extra,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.Issuer,
+			Audience:  audience,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   subject.Subject,
+			ID:        uuid.NewString(),
+		},
+	}
+
+	accessToken, err := s.issueToken(claims)
+	if err != nil {
+		logger.Error("Error generating delegated token for ", subject.Subject, ": ", err)
+		return nil, err
+	}
+
+	logger.Info("Delegated token issued to ", actor.ID, " on behalf of ", subject.Subject)
+	return &TokenPair{
+		AccessToken: accessToken,
+		ExpiresIn:   int64(time.Until(expiresAt).Seconds()),
+		Scope:       scope,
+		TokenType:   tokenTypeBearer,
+	}, nil
+}
+
+// Refresh rotates a refresh token. client is the authenticated OAuth client
+// redeeming it, or nil for first-party refreshes at /api/v1/auth/refresh.
+// Presenting an already rotated token revokes its whole session.
+func (s *authService) Refresh(refreshToken string, client *models.OAuthClient, proof *DPoPProof) (*TokenPair, error) {
+	claims, stored, err := s.validateRefreshToken(refreshToken)
+	if err != nil {
+		logger.Error("Refresh failed, invalid refresh token: ", err)
+		return nil, errors.New("invalid token")
+	}
+
+	if err := s.checkRefreshClient(claims, client); err != nil {
+		logger.Error("Refresh failed for user ", stored.UserID, ": ", err)
+		return nil, err
+	}
+
+	session, err := s.getLiveSession(stored.SessionID)
+	if err != nil {
+		logger.Error("Refresh failed for user ", stored.UserID, ": ", err)
+		return nil, err
+	}
+
+	// A session started with a DPoP key can only be refreshed by its holder.
+	if session.DPoPJKT != "" {
+		jkt, err := s.verifyProof(proof, "")
+		if err != nil {
+			logger.Error("Refresh failed, invalid DPoP proof for user ", stored.UserID, ": ", err)
+			return nil, err
+		}
+		if jkt != session.DPoPJKT {
+			logger.Error("Refresh failed, DPoP key mismatch for session ", session.ID)
+			return nil, errors.New("DPoP proof does not match the session key")
+		}
+	}
+
+	rotated, err := s.refreshTokenRepo.MarkTokenRotated(stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		logger.Error("Refresh token reuse detected for user ", stored.UserID, ", revoking session ", stored.SessionID)
+		if err := s.sessionRepo.RevokeSession(stored.SessionID); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("token revoked")
+	}
+
+	user, err := s.userRepo.GetUserByID(stored.UserID)
+	if err != nil {
+		logger.Error("Error retrieving user for refresh: ", err)
+		return nil, errors.New("invalid token")
+	}
+
+	if !user.IsActive {
+		logger.Error("Refresh failed, account not activated: ", user.Email)
+		return nil, errors.New("account not activated")
+	}
+
+	if claims.Version != user.TokenVersion {
+		logger.Error("Refresh failed, stale token version for user ", user.Email)
+		return nil, errors.New("token revoked")
+	}
+
+	session.ExpiresAt = time.Now().Add(s.cfg.RefreshExpiry)
+	if err := s.sessionRepo.ExtendSession(session.ID, session.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokenPair(user, session, "")
+}
+
+// checkRefreshClient makes sure a refresh token is redeemed by the client it
+// was issued to. Tokens of confidential clients cannot be refreshed through
+// the first-party endpoint, which would skip client authentication.
+func (s *authService) checkRefreshClient(claims *models.CustomClaims, client *models.OAuthClient) error {
+	if client != nil {
+		if claims.ClientID != client.ID {
+			return errors.New("refresh token was issued to another client")
+		}
+		return nil
+	}
+
+	if claims.ClientID == "" {
+		return nil
+	}
+	issuedTo, err := s.clientRepo.GetClientByID(claims.ClientID)
+	if err == nil && issuedTo.IsConfidential() {
+		return errors.New("refresh token must be redeemed at the token endpoint")
+	}
+	return nil
+}
+
+func (s *authService) Logout(accessToken string, proof *DPoPProof) error {
+	claims, err := s.ValidateDPoPToken(accessToken, proof)
+	if err != nil {
+		logger.Error("Logout failed, invalid access token: ", err)
+		return err
+	}
+
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return errors.New("invalid token")
+	}
+
+	if err := s.sessionRepo.RevokeSession(sessionID); err != nil {
+		logger.Error("Error revoking session ", sessionID, ": ", err)
+		return err
+	}
+
+	logger.Info("Session ", sessionID, " revoked for user ", claims.UserID)
+	return nil
+}
+
+func (s *authService) LogoutAll(accessToken string, proof *DPoPProof) error {
+	claims, err := s.ValidateDPoPToken(accessToken, proof)
+	if err != nil {
+		logger.Error("Logout from all devices failed, invalid access token: ", err)
+		return err
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return errors.New("invalid token")
+	}
+
+	if err := s.userRepo.IncrementTokenVersion(userID); err != nil {
+		logger.Error("Error revoking all tokens for user ", userID, ": ", err)
+		return err
+	}
+
+	logger.Info("All tokens revoked for user ", userID)
+	return nil
+}
+
+func (s *authService) checkTokenVersion(claims *models.CustomClaims) error {
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return errors.New("invalid token")
+	}
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return errors.New("invalid token")
+	}
+
+	if claims.Version != user.TokenVersion {
+		return errors.New("token revoked")
+	}
+	return nil
+}
+
+func (s *authService) getLiveSession(id uuid.UUID) (*models.Session, error) {
+	session, err := s.sessionRepo.GetSessionByID(id)
+	if err != nil {
+		return nil, errors.New("invalid session")
+	}
+
+	if session.RevokedAt != nil {
+		return nil, errors.New("session revoked")
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return nil, errors.New("session expired")
+	}
+
+	return session, nil
+}
+
+func (s *authService) issueTokenPair(user *models.User, session *models.Session, nonce string) (*TokenPair, error) {
+	accessToken, err := s.generateJWTToken(user, session, models.TokenUseAccess, s.cfg.JWTExpiry, uuid.NewString())
+	if err != nil {
+		logger.Error("Error generating access token for ", user.Email, ": ", err)
+		return nil, err
+	}
+
+	refreshID := uuid.New()
+	refreshToken, err := s.generateJWTToken(user, session, models.TokenUseRefresh, s.cfg.RefreshExpiry, refreshID.String())
+	if err != nil {
+		logger.Error("Error generating refresh token for ", user.Email, ": ", err)
+		return nil, err
+	}
+
+	if err := s.refreshTokenRepo.CreateToken(&models.RefreshToken{
+		ID:        refreshID,
+		UserID:    user.ID,
+		SessionID: session.ID,
+		ExpiresAt: time.Now().Add(s.cfg.RefreshExpiry),
+	}); err != nil {
+		logger.Error("Error saving refresh token for ", user.Email, ": ", err)
+		return nil, err
+	}
+
+	pair := &TokenPair{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
-	}, nil
+		ExpiresIn:    int64(s.cfg.JWTExpiry.Seconds()),
+		Scope:        session.Scope,
+		TokenType:    tokenTypeBearer,
+	}
+	if session.DPoPJKT != "" {
+		pair.TokenType = tokenTypeDPoP
+	}
+
+	// Relying parties cannot verify ID tokens signed with the JWT_SECRET they
+	// never see, so none are issued while it is the active key.
+	if GrantsOpenID(session.Scope) && !s.keys.SigningKey().IsSymmetric() {
+		pair.IDToken, err = s.generateIDToken(user, session, nonce)
+		if err != nil {
+			logger.Error("Error generating ID token for ", user.Email, ": ", err)
+			return nil, err
+		}
+	}
+
+	return pair, nil
 }
 
-func (s *authService) generateJWTToken(user *models.User, expiry time.Duration) (string, error) {
+func (s *authService) generateJWTToken(user *models.User, session *models.Session, tokenUse models.TokenUse, expiry time.Duration, tokenID string) (string, error) {
+	audience, err := s.audienceFor(session.ClientID)
+	if err != nil {
+		return "", err
+	}
+
 	claims := &models.CustomClaims{
-		UserID: user.ID.String(),
-		Role:   string(user.Role),
+		UserID:    user.ID.String(),
+		Role:      string(user.Role),
+		TokenUse:  tokenUse,
+		SessionID: session.ID.String(),
+		ClientID:  session.ClientID,
+		Scope:     session.Scope,
+		Version:   user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.Issuer,
+			Audience:  audience,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Subject:   user.ID.String(),
+			ID:        tokenID,
+		},
+	}
+
+	if tokenUse == models.TokenUseAccess {
+		claims.Extra, err = s.extraClaims(user, session)
+		if err != nil {
+			return "", err
+		}
+		if session.DPoPJKT != "" {
+			claims.Cnf = &models.Confirmation{JKT: session.DPoPJKT}
+		}
+	}
+
+	return s.issueToken(claims)
+}
+
+func (s *authService) generateIDToken(user *models.User, session *models.Session, nonce string) (string, error) {
+	clientID := session.ClientID
+	if clientID == "" {
+		clientID = s.cfg.OIDCClientID
+	}
+
+	claims := &models.IDTokenClaims{
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Nonce:         nonce,
+		AuthTime:      jwt.NewNumericDate(session.CreatedAt),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.Issuer,
+			Audience:  jwt.ClaimStrings{clientID},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.cfg.JWTExpiry)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   user.ID.String(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.cfg.JWTSecret))
+	// OpenID Connect requires ID tokens to be JWTs whatever TOKEN_FORMAT says.
+	jwtFormat := &tokenformat.JWT{Keys: s.keys}
+	return jwtFormat.SignClaims(claims)
+}
+
+func (s *authService) audienceFor(clientID string) (jwt.ClaimStrings, error) {
+	if clientID == "" {
+		return s.cfg.JWTAudience, nil
+	}
+
+	if audience, ok := s.cfg.ClientAudiences[clientID]; ok {
+		return audience, nil
+	}
+
+	client, err := s.clientRepo.GetClientByID(clientID)
+	if err != nil {
+		return nil, errors.New("unknown client")
+	}
+	if len(client.Audiences) == 0 {
+		return s.cfg.JWTAudience, nil
+	}
+	return client.Audiences, nil
+}
+
+// GrantsOpenID reports whether tokens with the given scope come with an ID
+// token and may be used at /userinfo. Password logins carry no scope and are
+// OpenID sign-ins of their own; OAuth clients have to ask for the openid
+// scope.
+func GrantsOpenID(scope string) bool {
+	return scope == "" || hasScope(scope, "openid")
+}
+
+func hasScope(scope, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
+
+// issueToken signs the claims in the configured token format, or with
+// OPAQUE_TOKENS stores them under a random token that reveals nothing to its
+// bearer.
+func (s *authService) issueToken(claims *models.CustomClaims) (string, error) {
+	if !s.cfg.OpaqueTokens {
+		return s.format.Sign(claims)
+	}
+
+	tokenString, err := generateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	token := &models.OpaqueToken{
+		TokenHash: hashToken(tokenString),
+		Claims:    raw,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if userID, err := uuid.Parse(claims.UserID); err == nil {
+		token.UserID = &userID
+	}
+
+	if err := s.opaqueTokenRepo.CreateToken(token); err != nil {
+		return "", err
+	}
+	return tokenString, nil
+}
+
+func (s *authService) lookupOpaqueToken(tokenString string) (*models.CustomClaims, error) {
+	token, err := s.opaqueTokenRepo.GetTokenByHash(hashToken(tokenString))
+	if err != nil {
+		return nil, errors.New("invalid token")
+	}
+
+	claims := &models.CustomClaims{}
+	if err := json.Unmarshal(token.Claims, claims); err != nil {
+		logger.Error("Error decoding stored claims: ", err)
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+func hashToken(tokenString string) string {
+	sum := sha256.Sum256([]byte(tokenString))
+	return hex.EncodeToString(sum[:])
+}
+
+func hashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
 }
 
 func generateRandomToken(n int) (string, error) {
@@ -190,6 +759,7 @@ func (s *authService) ConfirmAccount(tokenString string) error {
 	}
 
 	user.IsActive = true
+	user.EmailVerified = true
 	if err := s.userRepo.UpdateUser(user); err != nil {
 		logger.Error("Error updating user status for ", user.Email, ": ", err)
 		return err
@@ -258,12 +828,12 @@ func (s *authService) ResetPassword(tokenStr, newPassword string) error {
 		return err
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(newPassword)
 	if err != nil {
 		logger.Error("Error hashing new password for user ", user.Email, ": ", err)
 		return err
 	}
-	user.PasswordHash = string(hashedPassword)
+	user.PasswordHash = hashedPassword
 
 	if err := s.userRepo.UpdateUser(user); err != nil {
 		logger.Error("Error updating password for user ", user.Email, ": ", err)
@@ -275,28 +845,268 @@ func (s *authService) ResetPassword(tokenStr, newPassword string) error {
 		return err
 	}
 
+	if err := s.userRepo.IncrementTokenVersion(user.ID); err != nil {
+		logger.Error("Error revoking existing tokens for user ", user.Email, ": ", err)
+		return err
+	}
+
 	return nil
 }
 
 func (s *authService) ValidateToken(tokenString string) (*models.CustomClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &models.CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
+	return s.ValidateDPoPToken(tokenString, nil)
+}
+
+// ValidateDPoPToken accepts DPoP-bound tokens only together with a proof
+// signed by the key they are bound to.
+func (s *authService) ValidateDPoPToken(tokenString string, proof *DPoPProof) (*models.CustomClaims, error) {
+	claims, err := s.validateAccessToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Cnf != nil {
+		jkt, err := s.verifyProof(proof, tokenString)
+		if err != nil {
+			logger.Error("Token rejected for ", claims.Subject, ": ", err)
+			return nil, err
 		}
-		return []byte(s.cfg.JWTSecret), nil
-	})
+		if jkt != claims.Cnf.JKT {
+			logger.Error("Token rejected for ", claims.Subject, ": DPoP key mismatch")
+			return nil, errors.New("DPoP proof does not match the token key")
+		}
+	}
+
+	return claims, nil
+}
+
+func (s *authService) validateAccessToken(tokenString string) (*models.CustomClaims, error) {
+	claims, err := s.parseToken(tokenString, models.TokenUseAccess)
 	if err != nil {
 		return nil, err
 	}
 
-	claims, ok := token.Claims.(*models.CustomClaims)
-	if !ok || !token.Valid {
-		return nil, errors.New("invalid token")
+	// Client credentials tokens have no user, hence no session or token
+	// version to check.
+	if claims.UserID != "" {
+		if err := s.checkUserToken(claims); err != nil {
+			logger.Error("Token rejected for user ", claims.UserID, ": ", err)
+			return nil, err
+		}
+	}
+
+	revoked, err := s.revokedTokenRepo.IsRevoked(claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		logger.Error("Token rejected for ", claims.Subject, ": token ", claims.ID, " revoked")
+		return nil, errors.New("token revoked")
+	}
+
+	return claims, nil
+}
+
+func (s *authService) checkUserToken(claims *models.CustomClaims) error {
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return errors.New("invalid token")
+	}
+
+	if _, err := s.getLiveSession(sessionID); err != nil {
+		return err
+	}
+
+	return s.checkTokenVersion(claims)
+}
+
+func (s *authService) ValidateTokenForAudience(tokenString, audience string, proof *DPoPProof) (*models.CustomClaims, error) {
+	claims, err := s.ValidateDPoPToken(tokenString, proof)
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyAudience(audience, true) {
+		logger.Error("Token rejected for user ", claims.UserID, ": audience ", audience, " not allowed")
+		return nil, errors.New("invalid audience")
+	}
+
+	return claims, nil
+}
+
+func (s *authService) validateRefreshToken(tokenString string) (*models.CustomClaims, *models.RefreshToken, error) {
+	claims, err := s.parseToken(tokenString, models.TokenUseRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokenID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return nil, nil, errors.New("invalid token")
+	}
+
+	stored, err := s.refreshTokenRepo.GetTokenByID(tokenID)
+	if err != nil {
+		return nil, nil, errors.New("unknown refresh token")
+	}
+
+	return claims, stored, nil
+}
+
+func (s *authService) IntrospectToken(tokenString, tokenTypeHint string) (*models.CustomClaims, error) {
+	if tokenTypeHint == "refresh_token" {
+		if claims, err := s.introspectRefreshToken(tokenString); err == nil {
+			return claims, nil
+		}
+		return s.validateAccessToken(tokenString)
+	}
+
+	if claims, err := s.validateAccessToken(tokenString); err == nil {
+		return claims, nil
+	}
+	return s.introspectRefreshToken(tokenString)
+}
+
+// RevokeToken revokes a token on behalf of the client it was issued to. It
+// never reports unknown or invalid tokens, or tokens of other clients, as
+// errors: per RFC 7009 there is nothing for the caller to revoke there.
+func (s *authService) RevokeToken(tokenString, tokenTypeHint string, client *models.OAuthClient) error {
+	revokers := []func(string, *models.OAuthClient) (bool, error){s.revokeAccessToken, s.revokeRefreshToken}
+	if tokenTypeHint == "refresh_token" {
+		revokers = []func(string, *models.OAuthClient) (bool, error){s.revokeRefreshToken, s.revokeAccessToken}
+	}
+
+	for _, revoke := range revokers {
+		done, err := revoke(tokenString, client)
+		if err != nil || done {
+			return err
+		}
+	}
+
+	logger.Debug("Revocation requested for unknown token")
+	return nil
+}
+
+func (s *authService) revokeAccessToken(tokenString string, client *models.OAuthClient) (bool, error) {
+	claims, err := s.parseToken(tokenString, models.TokenUseAccess)
+	if err != nil {
+		return false, nil
+	}
+
+	if claims.ClientID != client.ID {
+		logger.Error("Client ", client.ID, " attempted to revoke access token ", claims.ID, " of client ", claims.ClientID)
+		return true, nil
+	}
+
+	if err := s.revokedTokenRepo.RevokeToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+		return false, err
+	}
+
+	logger.Info("Access token ", claims.ID, " revoked for user ", claims.UserID)
+	return true, nil
+}
+
+func (s *authService) revokeRefreshToken(tokenString string, client *models.OAuthClient) (bool, error) {
+	claims, stored, err := s.validateRefreshToken(tokenString)
+	if err != nil {
+		return false, nil
+	}
+
+	if claims.ClientID != client.ID {
+		logger.Error("Client ", client.ID, " attempted to revoke a refresh token of client ", claims.ClientID)
+		return true, nil
+	}
+
+	if err := s.sessionRepo.RevokeSession(stored.SessionID); err != nil {
+		return false, err
+	}
+
+	logger.Info("Session ", stored.SessionID, " revoked via refresh token for user ", stored.UserID)
+	return true, nil
+}
+
+// PurgeExpiredTokens deletes expired sessions, refresh tokens, opaque tokens
+// and revocations. None of them can validate past their expiry anyway.
+func (s *authService) PurgeExpiredTokens() (int64, error) {
+	now := time.Now()
+	purges := []func(time.Time) (int64, error){
+		s.sessionRepo.DeleteExpiredSessions,
+		s.refreshTokenRepo.DeleteExpiredTokens,
+		s.opaqueTokenRepo.DeleteExpiredTokens,
+		s.revokedTokenRepo.DeleteExpiredTokens,
+	}
+
+	var total int64
+	for _, purge := range purges {
+		n, err := purge(now)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func (s *authService) introspectRefreshToken(tokenString string) (*models.CustomClaims, error) {
+	claims, stored, err := s.validateRefreshToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.RotatedAt != nil {
+		return nil, errors.New("token already rotated")
+	}
+
+	if _, err := s.getLiveSession(stored.SessionID); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkTokenVersion(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (s *authService) parseToken(tokenString string, expectedUse models.TokenUse) (*models.CustomClaims, error) {
+	claims, err := s.decodeToken(tokenString)
+	if err != nil {
+		return nil, err
 	}
 
 	if claims.ExpiresAt == nil || claims.ExpiresAt.Time.Before(time.Now()) {
 		return nil, errors.New("token expired")
 	}
 
+	if claims.Issuer != s.cfg.Issuer {
+		logger.Error("Token rejected, unexpected issuer: ", claims.Issuer)
+		return nil, errors.New("invalid issuer")
+	}
+
+	if claims.TokenUse != expectedUse {
+		logger.Error("Token rejected, expected ", expectedUse, " token but got ", claims.TokenUse)
+		return nil, errors.New("invalid token type")
+	}
+
 	return claims, nil
 }
+
+// decodeToken accepts every format regardless of OPAQUE_TOKENS and
+// TOKEN_FORMAT, so tokens issued before a setting changed keep working until
+// they expire.
+func (s *authService) decodeToken(tokenString string) (*models.CustomClaims, error) {
+	if !strings.Contains(tokenString, ".") {
+		return s.lookupOpaqueToken(tokenString)
+	}
+
+	return tokenformat.ForToken(tokenString, s.keys).Parse(tokenString)
+}
+
+func (s *authService) GetUserByID(id uuid.UUID) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(id)
+	if err != nil {
+		logger.Error("Error retrieving user ", id, ": ", err)
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,621 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+
+	"authforge/config"
+	"authforge/internal/dpop"
+	"authforge/internal/keyring"
+	"authforge/internal/mailer"
+	"authforge/internal/models"
+	"authforge/internal/repository"
+	"authforge/internal/tokenformat"
+)
+
+const testIssuer = "https://auth.example.com"
+
+type fakeUserRepo struct {
+	repository.UserRepository
+	users map[uuid.UUID]*models.User
+}
+
+func (r *fakeUserRepo) GetUserByID(id uuid.UUID) (*models.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	return user, nil
+}
+
+func (r *fakeUserRepo) GetUserByEmail(email string) (*models.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (r *fakeUserRepo) CreateUser(user *models.User) error {
+	r.users[user.ID] = user
+	return nil
+}
+
+func (r *fakeUserRepo) ListUsers(filter *models.UserFilter) ([]*models.User, error) {
+	users := []*models.User{}
+	for _, user := range r.users {
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (r *fakeUserRepo) CountUsers(filter *models.UserFilter) (int, error) {
+	return len(r.users), nil
+}
+
+func (r *fakeUserRepo) UpdateUser(user *models.User) error {
+	r.users[user.ID] = user
+	return nil
+}
+
+func (r *fakeUserRepo) IncrementTokenVersion(id uuid.UUID) error {
+	r.users[id].TokenVersion++
+	return nil
+}
+
+type fakeConfirmationTokenRepo struct {
+	repository.ConfirmationTokenRepository
+}
+
+func (r *fakeConfirmationTokenRepo) CreateToken(token *models.ConfirmationToken) error {
+	return nil
+}
+
+type fakeMailer struct {
+	mailer.Mailer
+}
+
+func (m *fakeMailer) SendConfirmationEmail(to, token string) error {
+	return nil
+}
+
+func (m *fakeMailer) SendDataExportEmail(to, downloadURL string) error {
+	return nil
+}
+
+type fakeRefreshTokenRepo struct {
+	repository.RefreshTokenRepository
+	tokens map[uuid.UUID]*models.RefreshToken
+}
+
+func (r *fakeRefreshTokenRepo) CreateToken(token *models.RefreshToken) error {
+	r.tokens[token.ID] = token
+	return nil
+}
+
+func (r *fakeRefreshTokenRepo) GetTokenByID(id uuid.UUID) (*models.RefreshToken, error) {
+	token, ok := r.tokens[id]
+	if !ok {
+		return nil, errors.New("token not found")
+	}
+	return token, nil
+}
+
+func (r *fakeRefreshTokenRepo) MarkTokenRotated(id uuid.UUID) (bool, error) {
+	token, ok := r.tokens[id]
+	if !ok || token.RotatedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	token.RotatedAt = &now
+	return true, nil
+}
+
+type fakeSessionRepo struct {
+	repository.SessionRepository
+	sessions map[uuid.UUID]*models.Session
+}
+
+func (r *fakeSessionRepo) CreateSession(session *models.Session) error {
+	session.CreatedAt = time.Now()
+	r.sessions[session.ID] = session
+	return nil
+}
+
+func (r *fakeSessionRepo) GetSessionByID(id uuid.UUID) (*models.Session, error) {
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, errors.New("session not found")
+	}
+	return session, nil
+}
+
+func (r *fakeSessionRepo) ExtendSession(id uuid.UUID, expiresAt time.Time) error {
+	r.sessions[id].ExpiresAt = expiresAt
+	return nil
+}
+
+func (r *fakeSessionRepo) ListUserSessions(userID uuid.UUID) ([]*models.Session, error) {
+	var sessions []*models.Session
+	for _, session := range r.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *fakeSessionRepo) RevokeUserSessions(userID, except uuid.UUID) error {
+	now := time.Now()
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.ID != except && session.RevokedAt == nil {
+			session.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeSessionRepo) RevokeSession(id uuid.UUID) error {
+	now := time.Now()
+	r.sessions[id].RevokedAt = &now
+	return nil
+}
+
+type fakeRevokedTokenRepo struct {
+	repository.RevokedTokenRepository
+	revoked map[string]bool
+}
+
+func (r *fakeRevokedTokenRepo) RevokeToken(jti string, expiresAt time.Time) error {
+	r.revoked[jti] = true
+	return nil
+}
+
+func (r *fakeRevokedTokenRepo) IsRevoked(jti string) (bool, error) {
+	return r.revoked[jti], nil
+}
+
+type fakeClientRepo struct {
+	clients map[string]*models.OAuthClient
+}
+
+func (r *fakeClientRepo) GetClientByID(id string) (*models.OAuthClient, error) {
+	client, ok := r.clients[id]
+	if !ok {
+		return nil, errors.New("client not found")
+	}
+	return client, nil
+}
+
+type fakeAuditRepo struct {
+	repository.AuditEventRepository
+}
+
+func (r *fakeAuditRepo) RecordEvent(event *models.AuditEvent) error {
+	return nil
+}
+
+func (r *fakeAuditRepo) ListUserEvents(userID uuid.UUID) ([]*models.AuditEvent, error) {
+	return nil, nil
+}
+
+type testAuthService struct {
+	*authService
+	users    *fakeUserRepo
+	sessions *fakeSessionRepo
+	revoked  *fakeRevokedTokenRepo
+	clients  *fakeClientRepo
+}
+
+func newTestAuthService(t *testing.T) *testAuthService {
+	t.Helper()
+
+	key, err := keyring.Generate("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := keyring.New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		BaseURL:        testIssuer,
+		Issuer:         testIssuer,
+		JWTAudience:    []string{"api"},
+		JWTExpiry:      15 * time.Minute,
+		RefreshExpiry:  24 * time.Hour,
+		ExchangeExpiry: 5 * time.Minute,
+	}
+
+	ts := &testAuthService{
+		users:    &fakeUserRepo{users: make(map[uuid.UUID]*models.User)},
+		sessions: &fakeSessionRepo{sessions: make(map[uuid.UUID]*models.Session)},
+		revoked:  &fakeRevokedTokenRepo{revoked: make(map[string]bool)},
+		clients:  &fakeClientRepo{clients: make(map[string]*models.OAuthClient)},
+	}
+	ts.authService = NewAuthService(
+		ts.users,
+		&fakeConfirmationTokenRepo{},
+		nil,
+		&fakeRefreshTokenRepo{tokens: make(map[uuid.UUID]*models.RefreshToken)},
+		ts.sessions,
+		ts.revoked,
+		nil,
+		ts.clients,
+		&fakeAuditRepo{},
+		keys,
+		&tokenformat.JWT{Keys: keys},
+		dpop.NewVerifier(false),
+		cfg,
+		&fakeMailer{},
+	).(*authService)
+	return ts
+}
+
+func (ts *testAuthService) addUser() *models.User {
+	user := &models.User{
+		ID:       uuid.New(),
+		Email:    "user@example.com",
+		IsActive: true,
+		Role:     models.RoleAdmin,
+	}
+	ts.users.users[user.ID] = user
+	return user
+}
+
+func (ts *testAuthService) sessionOf(t *testing.T, tokenString string) *models.Session {
+	t.Helper()
+	claims, err := ts.decodeToken(tokenString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := ts.sessions.GetSessionByID(uuid.MustParse(claims.SessionID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	tests := []struct {
+		name          string
+		presentations int
+		wantErr       string
+		wantRevoked   bool
+	}{
+		{name: "first use rotates", presentations: 1},
+		{name: "reuse revokes the session", presentations: 2, wantErr: "token revoked", wantRevoked: true},
+		{name: "later reuse finds the session revoked", presentations: 3, wantErr: "session revoked", wantRevoked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestAuthService(t)
+			pair, err := ts.IssueTokens(ts.addUser(), "", "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var rotated *TokenPair
+			for i := 0; i < tt.presentations; i++ {
+				next, err := ts.Refresh(pair.RefreshToken, nil, nil)
+				if i == 0 {
+					if err != nil {
+						t.Fatalf("first refresh failed: %v", err)
+					}
+					rotated = next
+					continue
+				}
+				if i == tt.presentations-1 && (err == nil || err.Error() != tt.wantErr) {
+					t.Fatalf("refresh #%d: got error %v, want %q", i+1, err, tt.wantErr)
+				}
+			}
+
+			session := ts.sessionOf(t, pair.RefreshToken)
+			if revoked := session.RevokedAt != nil; revoked != tt.wantRevoked {
+				t.Fatalf("session revoked = %v, want %v", revoked, tt.wantRevoked)
+			}
+
+			// Once reuse is detected the legitimate successor is dead too.
+			_, err = ts.Refresh(rotated.RefreshToken, nil, nil)
+			if tt.wantRevoked && err == nil {
+				t.Fatal("rotated token still works after reuse was detected")
+			}
+			if !tt.wantRevoked && err != nil {
+				t.Fatalf("rotated token rejected: %v", err)
+			}
+		})
+	}
+}
+
+func TestRefreshFirstPartyClients(t *testing.T) {
+	tests := []struct {
+		name     string
+		issuedTo string
+		wantErr  string
+	}{
+		{name: "first-party session", issuedTo: ""},
+		{name: "public client session", issuedTo: "spa"},
+		{name: "confidential client session", issuedTo: "backend", wantErr: "refresh token must be redeemed at the token endpoint"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestAuthService(t)
+			ts.clients.clients["spa"] = &models.OAuthClient{ID: "spa"}
+			ts.clients.clients["backend"] = &models.OAuthClient{ID: "backend", SecretHash: "hash"}
+
+			pair, err := ts.IssueTokens(ts.addUser(), tt.issuedTo, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = ts.Refresh(pair.RefreshToken, nil, nil)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("refresh failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIssueDelegatedTokenClaims(t *testing.T) {
+	actor := &models.OAuthClient{ID: "reports", Audiences: []string{"billing", "reports"}}
+
+	tests := []struct {
+		name          string
+		subjectExpiry time.Duration
+		subjectAct    *models.Actor
+		audience      []string
+		wantAudience  []string
+		wantErr       string
+	}{
+		{name: "audience defaults to what both may reach", subjectExpiry: time.Hour, wantAudience: []string{"billing"}},
+		{name: "requested audience", subjectExpiry: time.Hour, audience: []string{"billing"}, wantAudience: []string{"billing"}},
+		{name: "audience the actor may not reach", subjectExpiry: time.Hour, audience: []string{"api"}, wantErr: "invalid_target"},
+		{name: "audience outside the subject token", subjectExpiry: time.Hour, audience: []string{"reports"}, wantErr: "invalid_target"},
+		{name: "expiry capped at the subject token", subjectExpiry: time.Minute, wantAudience: []string{"billing"}},
+		{name: "delegation chain is kept", subjectExpiry: time.Hour, subjectAct: &models.Actor{Subject: "gateway"}, wantAudience: []string{"billing"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestAuthService(t)
+			ts.clients.clients[actor.ID] = actor
+
+			userID := uuid.NewString()
+			subject := &models.CustomClaims{
+				UserID:    userID,
+				Role:      string(models.RoleAdmin),
+				TokenUse:  models.TokenUseAccess,
+				SessionID: uuid.NewString(),
+				Act:       tt.subjectAct,
+				RegisteredClaims: jwt.RegisteredClaims{
+					Issuer:    testIssuer,
+					Audience:  jwt.ClaimStrings{"api", "billing"},
+					ExpiresAt: jwt.NewNumericDate(time.Now().Add(tt.subjectExpiry)),
+					Subject:   userID,
+				},
+			}
+
+			pair, err := ts.IssueDelegatedToken(subject, actor, "read", tt.audience)
+			if tt.wantErr != "" {
+				var oauthErr *OAuthError
+				if !errors.As(err, &oauthErr) || oauthErr.Code != tt.wantErr {
+					t.Fatalf("got error %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := ts.decodeToken(pair.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Role != "" {
+				t.Errorf("role = %q, delegated tokens must not carry one", claims.Role)
+			}
+			if claims.Subject != userID || claims.UserID != userID {
+				t.Errorf("subject = %q, user_id = %q, want %q", claims.Subject, claims.UserID, userID)
+			}
+			if claims.ClientID != actor.ID || claims.Scope != "read" {
+				t.Errorf("client_id = %q, scope = %q", claims.ClientID, claims.Scope)
+			}
+			if claims.Act == nil || claims.Act.Subject != actor.ID {
+				t.Fatalf("act = %+v, want sub %q", claims.Act, actor.ID)
+			}
+			if tt.subjectAct != nil && (claims.Act.Act == nil || claims.Act.Act.Subject != tt.subjectAct.Subject) {
+				t.Errorf("nested act = %+v, want sub %q", claims.Act.Act, tt.subjectAct.Subject)
+			}
+			if !slices.Equal(claims.Audience, tt.wantAudience) {
+				t.Errorf("aud = %v, want %v", claims.Audience, tt.wantAudience)
+			}
+			if claims.ExpiresAt.After(subject.ExpiresAt.Time) {
+				t.Errorf("expires at %v, after the subject token's %v", claims.ExpiresAt, subject.ExpiresAt)
+			}
+		})
+	}
+}
+
+func dpopProof(t *testing.T, key *ecdsa.PrivateKey, method, url, accessToken string) string {
+	t.Helper()
+	claims := jwt.MapClaims{
+		"htm": method,
+		"htu": url,
+		"jti": uuid.NewString(),
+		"iat": time.Now().Unix(),
+	}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		claims["ath"] = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	jwk, _ := keyring.PublicJWK(&key.PublicKey)
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = jwk
+	proof, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+func TestDPoPKeyBinding(t *testing.T) {
+	sessionKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, _ := keyring.PublicJWK(&sessionKey.PublicKey)
+	jkt, err := keyring.Thumbprint(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     *ecdsa.PrivateKey
+		wantErr bool
+	}{
+		{name: "proof by the bound key", key: sessionKey},
+		{name: "proof by another key", key: otherKey, wantErr: true},
+		{name: "no proof", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestAuthService(t)
+			pair, err := ts.startSession(ts.addUser(), "", "", "", jkt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pair.TokenType != tokenTypeDPoP {
+				t.Fatalf("token type = %q, want %q", pair.TokenType, tokenTypeDPoP)
+			}
+
+			var useProof, refreshProof *DPoPProof
+			if tt.key != nil {
+				useProof = &DPoPProof{
+					Proof:  dpopProof(t, tt.key, "GET", testIssuer+"/api/v1/me", pair.AccessToken),
+					Method: "GET",
+					URL:    "/api/v1/me",
+				}
+				refreshProof = &DPoPProof{
+					Proof:  dpopProof(t, tt.key, "POST", testIssuer+"/api/v1/auth/refresh", ""),
+					Method: "POST",
+					URL:    "/api/v1/auth/refresh",
+				}
+			}
+
+			_, err = ts.ValidateDPoPToken(pair.AccessToken, useProof)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("access token: got error %v, want error %v", err, tt.wantErr)
+			}
+
+			_, err = ts.Refresh(pair.RefreshToken, nil, refreshProof)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("refresh: got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegisterUserIgnoresRequestedRole(t *testing.T) {
+	tests := []struct {
+		name string
+		role models.UserRole
+	}{
+		{name: "no role", role: ""},
+		{name: "user role", role: models.RoleUser},
+		{name: "admin role", role: models.RoleAdmin},
+		{name: "unknown role", role: "superuser"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestAuthService(t)
+			user := &models.User{Email: "new@example.com", Role: tt.role}
+			if err := ts.RegisterUser(user, "password"); err != nil {
+				t.Fatal(err)
+			}
+
+			stored, err := ts.users.GetUserByEmail("new@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Role != models.RoleUser {
+				t.Fatalf("role = %q, want %q", stored.Role, models.RoleUser)
+			}
+		})
+	}
+}
+
+func TestIDTokensGoWithOpenIDSignIns(t *testing.T) {
+	tests := []struct {
+		name        string
+		scope       string
+		hmac        bool
+		wantIDToken bool
+		wantOpenID  bool
+	}{
+		{name: "password login", scope: "", wantIDToken: true, wantOpenID: true},
+		{name: "openid scope", scope: "openid email", wantIDToken: true, wantOpenID: true},
+		{name: "no openid scope", scope: "email"},
+		{name: "openid scope signed with JWT_SECRET", scope: "openid", hmac: true, wantOpenID: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestAuthService(t)
+			if tt.hmac {
+				secret := []byte("test-secret")
+				hmacKeys, err := keyring.New(&keyring.Key{
+					Algorithm:  jwt.SigningMethodHS256.Alg(),
+					PrivateKey: secret,
+					PublicKey:  secret,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				ts.keys.Replace(hmacKeys)
+			}
+			pair, err := ts.IssueTokens(ts.addUser(), "", tt.scope, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// /userinfo accepts the access tokens that would come with an ID token
+			// under an asymmetric key.
+			claims, err := ts.ValidateToken(pair.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := pair.IDToken != ""; got != tt.wantIDToken {
+				t.Errorf("ID token issued = %v, want %v", got, tt.wantIDToken)
+			}
+			if got := GrantsOpenID(claims.Scope); got != tt.wantOpenID {
+				t.Errorf("GrantsOpenID(%q) = %v, want %v", claims.Scope, got, tt.wantOpenID)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"authforge/internal/models"
+)
+
+// ClaimsProvider adds extra claims to access tokens. Providers run every time
+// an access token is issued, at login and on refresh.
+type ClaimsProvider interface {
+	Name() string
+	Claims(user *models.User, session *models.Session) (map[string]interface{}, error)
+}
+
+type emailClaimsProvider struct{}
+
+func (emailClaimsProvider) Name() string {
+	return "email"
+}
+
+func (emailClaimsProvider) Claims(user *models.User, session *models.Session) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+	}, nil
+}
+
+// BuiltinClaimsProviders are the providers that can be enabled by name with
+// TOKEN_CLAIMS_PROVIDERS.
+var BuiltinClaimsProviders = map[string]ClaimsProvider{
+	"email": emailClaimsProvider{},
+}
+
+func (s *authService) RegisterClaimsProvider(provider ClaimsProvider) {
+	s.claimsProviders = append(s.claimsProviders, provider)
+}
+
+func (s *authService) extraClaims(user *models.User, session *models.Session) (map[string]interface{}, error) {
+	if len(s.claimsProviders) == 0 {
+		return nil, nil
+	}
+
+	extra := make(map[string]interface{})
+	for _, provider := range s.claimsProviders {
+		claims, err := provider.Claims(user, session)
+		if err != nil {
+			return nil, fmt.Errorf("claims provider %s: %w", provider.Name(), err)
+		}
+		for name, value := range claims {
+			if models.ReservedClaims[name] {
+				return nil, fmt.Errorf("claims provider %s: claim %q is reserved", provider.Name(), name)
+			}
+			if _, exists := extra[name]; exists {
+				return nil, fmt.Errorf("claims provider %s: claim %q already set by another provider", provider.Name(), name)
+			}
+			extra[name] = value
+		}
+	}
+
+	raw, err := json.Marshal(extra)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > s.cfg.MaxExtraClaimsSize {
+		return nil, fmt.Errorf("extra claims take %d bytes, limit is %d", len(raw), s.cfg.MaxExtraClaimsSize)
+	}
+	return extra, nil
+}
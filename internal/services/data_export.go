@@ -0,0 +1,171 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"authforge/internal/logger"
+	"authforge/internal/models"
+)
+
+// exportReuseWindow is how long a finished export is handed out again instead
+// of building and mailing a new one.
+const exportReuseWindow = time.Hour
+
+// PersonalDataExport is everything AuthForge stores about a user. Secrets
+// such as the password hash and token values are left out.
+type PersonalDataExport struct {
+	ExportedAt    time.Time               `json:"exportedAt"`
+	User          *models.User            `json:"user"`
+	LoginHistory  []*models.AuditEvent    `json:"loginHistory"`
+	Sessions      []*models.Session       `json:"sessions"`
+	AuditEvents   []*models.AuditEvent    `json:"auditEvents"`
+	PendingTokens []*models.TokenMetadata `json:"pendingTokens"`
+}
+
+// ExportData returns the user's data right away when there is little of it or
+// EXPORT_SYNC_MAX_RECORDS is negative. Otherwise the archive is built in the
+// background and a download link is mailed to the user, in which case
+// ExportData returns nil. While an export is pending, or within an hour of the
+// last one, no new one is started.
+func (s *accountService) ExportData(userID uuid.UUID) (*PersonalDataExport, error) {
+	user, err := s.GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := s.exportRepo.CountUserRecords(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if s.cfg.ExportSyncMaxRecords < 0 || records <= s.cfg.ExportSyncMaxRecords {
+		return s.collectData(user)
+	}
+
+	recent, err := s.exportRepo.GetRecentExport(user.ID, time.Now().Add(-exportReuseWindow))
+	if err != nil {
+		return nil, err
+	}
+	if recent != nil {
+		logger.Info("Data export ", recent.ID, " of user ", user.ID, " reused")
+		return nil, nil
+	}
+
+	export := &models.DataExport{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Status:    models.DataExportPending,
+		ExpiresAt: time.Now().Add(s.cfg.ExportLinkExpiry),
+	}
+	if err := s.exportRepo.CreateExport(export); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Data export ", export.ID, " queued for user ", user.ID)
+	go s.generateExport(export, user)
+	return nil, nil
+}
+
+func (s *accountService) collectData(user *models.User) (*PersonalDataExport, error) {
+	sessions, err := s.sessionRepo.ListUserSessions(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.auditRepo.ListUserEvents(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.exportRepo.ListPendingTokens(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &PersonalDataExport{
+		ExportedAt:    time.Now(),
+		User:          user,
+		LoginHistory:  []*models.AuditEvent{},
+		Sessions:      sessions,
+		AuditEvents:   []*models.AuditEvent{},
+		PendingTokens: tokens,
+	}
+	for _, event := range events {
+		if event.Event == models.AuditLogin {
+			data.LoginHistory = append(data.LoginHistory, event)
+		} else {
+			data.AuditEvents = append(data.AuditEvents, event)
+		}
+	}
+	return data, nil
+}
+
+func (s *accountService) generateExport(export *models.DataExport, user *models.User) {
+	data, err := s.collectData(user)
+	if err == nil {
+		var archive []byte
+		if archive, err = json.Marshal(data); err == nil {
+			err = s.exportRepo.CompleteExport(export.ID, archive)
+		}
+	}
+	if err != nil {
+		logger.Error("Error generating data export ", export.ID, ": ", err)
+		s.exportRepo.FailExport(export.ID)
+		return
+	}
+
+	if err := s.mailer.SendDataExportEmail(user.Email, s.exportURL(export)); err != nil {
+		logger.Error("Error sending data export link to ", user.Email, ": ", err)
+		return
+	}
+	logger.Info("Data export ", export.ID, " ready for user ", user.ID)
+}
+
+func (s *accountService) exportURL(export *models.DataExport) string {
+	expires := export.ExpiresAt.Unix()
+	query := url.Values{
+		"id":      {export.ID.String()},
+		"expires": {fmt.Sprint(expires)},
+		"sig":     {s.signExport(export.ID, expires)},
+	}
+	return s.cfg.BaseURL + "/api/v1/me/export/download?" + query.Encode()
+}
+
+func (s *accountService) signExport(id uuid.UUID, expires int64) string {
+	mac := hmac.New(sha256.New, s.exportLinkSecret)
+	fmt.Fprintf(mac, "%s.%d", id, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// DownloadExport checks a signed link from an export email and returns the
+// archive it points to.
+func (s *accountService) DownloadExport(id uuid.UUID, expires int64, signature string) (*models.DataExport, error) {
+	if !hmac.Equal([]byte(signature), []byte(s.signExport(id, expires))) {
+		logger.Error("Data export download failed, invalid signature for ", id)
+		return nil, errors.New("invalid or expired link")
+	}
+	if time.Now().Unix() >= expires {
+		return nil, errors.New("invalid or expired link")
+	}
+
+	export, err := s.exportRepo.GetExport(id)
+	if err != nil || time.Now().After(export.ExpiresAt) {
+		return nil, errors.New("invalid or expired link")
+	}
+	if export.Status != models.DataExportReady {
+		return nil, errors.New("export is not ready")
+	}
+	return export, nil
+}
+
+func (s *accountService) PurgeExpiredExports() (int64, error) {
+	return s.exportRepo.DeleteExpiredExports(time.Now())
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"authforge/config"
+	"authforge/internal/models"
+	"authforge/internal/repository"
+)
+
+type fakeDataExportRepo struct {
+	repository.DataExportRepository
+	records int
+	recent  *models.DataExport
+	since   time.Time
+	created []*models.DataExport
+}
+
+func (r *fakeDataExportRepo) CountUserRecords(userID uuid.UUID) (int, error) {
+	return r.records, nil
+}
+
+func (r *fakeDataExportRepo) GetRecentExport(userID uuid.UUID, since time.Time) (*models.DataExport, error) {
+	r.since = since
+	return r.recent, nil
+}
+
+func (r *fakeDataExportRepo) CreateExport(export *models.DataExport) error {
+	r.created = append(r.created, export)
+	return nil
+}
+
+func (r *fakeDataExportRepo) CompleteExport(id uuid.UUID, archive []byte) error {
+	return nil
+}
+
+func (r *fakeDataExportRepo) ListPendingTokens(userID uuid.UUID) ([]*models.TokenMetadata, error) {
+	return nil, nil
+}
+
+func TestExportData(t *testing.T) {
+	pending := &models.DataExport{ID: uuid.New(), Status: models.DataExportPending}
+
+	tests := []struct {
+		name        string
+		records     int
+		maxRecords  int
+		recent      *models.DataExport
+		wantData    bool
+		wantCreated bool
+	}{
+		{name: "few records are exported right away", records: 10, maxRecords: 1000, wantData: true},
+		{name: "many records are exported in the background", records: 2000, maxRecords: 1000, wantCreated: true},
+		{name: "recent export is reused", records: 2000, maxRecords: 1000, recent: pending},
+		{name: "negative limit disables background exports", records: 2000, maxRecords: -1, wantData: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &fakeUserRepo{users: make(map[uuid.UUID]*models.User)}
+			user := &models.User{ID: uuid.New(), Email: "user@example.com", IsActive: true}
+			users.users[user.ID] = user
+			exports := &fakeDataExportRepo{records: tt.records, recent: tt.recent}
+			cfg := &config.Config{
+				ExportSyncMaxRecords: tt.maxRecords,
+				ExportLinkSecret:     "secret",
+				ExportLinkExpiry:     24 * time.Hour,
+			}
+			s := NewAccountService(
+				users,
+				nil,
+				&fakeSessionRepo{sessions: make(map[uuid.UUID]*models.Session)},
+				nil,
+				&fakeAuditRepo{},
+				exports,
+				&fakeMailer{},
+				cfg,
+			)
+
+			data, err := s.ExportData(user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (data != nil) != tt.wantData {
+				t.Fatalf("returned data = %v, want %v", data != nil, tt.wantData)
+			}
+			if (len(exports.created) == 1) != tt.wantCreated || len(exports.created) > 1 {
+				t.Fatalf("created %d exports, want new export %v", len(exports.created), tt.wantCreated)
+			}
+			if !tt.wantData {
+				if window := time.Since(exports.since); window < exportReuseWindow || window > exportReuseWindow+time.Minute {
+					t.Fatalf("looked for exports created in the last %v, want %v", window, exportReuseWindow)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	tokenTypeBearer = "Bearer"
+	tokenTypeDPoP   = "DPoP"
+)
+
+// DPoPProof is the DPoP header of a request together with the method and URL
+// it was sent to. A URL starting with "/" is taken relative to BASE_URL.
+type DPoPProof struct {
+	Proof  string
+	Method string
+	URL    string
+}
+
+func (s *authService) DPoPNonce() string {
+	return s.dpop.Nonce()
+}
+
+// verifyProof returns the thumbprint of the proof key, or "" when no proof
+// was sent.
+func (s *authService) verifyProof(proof *DPoPProof, accessToken string) (string, error) {
+	if proof == nil || proof.Proof == "" {
+		if accessToken != "" {
+			return "", errors.New("DPoP proof required")
+		}
+		return "", nil
+	}
+
+	requestURL := proof.URL
+	if strings.HasPrefix(requestURL, "/") {
+		requestURL = s.cfg.BaseURL + requestURL
+	}
+	return s.dpop.Verify(proof.Proof, proof.Method, requestURL, accessToken)
+}
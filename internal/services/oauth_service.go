@@ -0,0 +1,580 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"authforge/config"
+	"authforge/internal/logger"
+	"authforge/internal/models"
+	"authforge/internal/repository"
+)
+
+const (
+	authorizationCodeTTL = 5 * time.Minute
+	deviceCodeTTL        = 10 * time.Minute
+	devicePollInterval   = 5
+	userCodeAlphabet     = "BCDFGHJKLMNPQRSTVWXZ"
+
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+type OAuthService interface {
+	AuthenticateClient(clientID, clientSecret string) error
+	ResolveClient(clientID, clientSecret string) (*models.OAuthClient, error)
+	Introspect(token, tokenTypeHint string) (*Introspection, error)
+	Revoke(client *models.OAuthClient, token, tokenTypeHint string) error
+	ParseAuthorizationRequest(params url.Values) (*AuthorizationRequest, error)
+	Authorize(req *AuthorizationRequest, email, password string) (string, error)
+	ExchangeAuthorizationCode(clientID, code, redirectURI, codeVerifier string) (*TokenPair, error)
+	RefreshToken(client *models.OAuthClient, refreshToken string) (*TokenPair, error)
+	ClientCredentials(client *models.OAuthClient, scope string) (*TokenPair, error)
+	ExchangeToken(client *models.OAuthClient, req *TokenExchangeRequest) (*TokenPair, error)
+	StartDeviceAuthorization(client *models.OAuthClient, scope string) (*DeviceAuthorization, error)
+	GetDeviceAuthorization(userCode string) (*models.DeviceCode, *models.OAuthClient, error)
+	CompleteDeviceAuthorization(userCode, email, password string, approved bool) (*models.OAuthClient, error)
+	PollDeviceToken(client *models.OAuthClient, deviceCode string) (*TokenPair, error)
+}
+
+type oauthService struct {
+	authService AuthService
+	clientRepo  repository.OAuthClientRepository
+	codeRepo    repository.AuthorizationCodeRepository
+	deviceRepo  repository.DeviceCodeRepository
+	cfg         *config.Config
+}
+
+// OAuthError carries an RFC 6749 error code so handlers can report it verbatim.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func newOAuthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+type AuthorizationRequest struct {
+	Client              *models.OAuthClient
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+type Introspection struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	JTI       string   `json:"jti,omitempty"`
+	Role      string   `json:"role,omitempty"`
+
+	Cnf *models.Confirmation `json:"cnf,omitempty"`
+}
+
+func NewOAuthService(
+	authService AuthService,
+	clientRepo repository.OAuthClientRepository,
+	codeRepo repository.AuthorizationCodeRepository,
+	deviceRepo repository.DeviceCodeRepository,
+	cfg *config.Config,
+) OAuthService {
+	logger.Info("Initializing OAuthService")
+	return &oauthService{
+		authService: authService,
+		clientRepo:  clientRepo,
+		codeRepo:    codeRepo,
+		deviceRepo:  deviceRepo,
+		cfg:         cfg,
+	}
+}
+
+// AuthenticateClient requires a secret: it accepts confidential OAuth clients
+// as well as the static INTROSPECTION_CLIENTS credentials.
+func (s *oauthService) AuthenticateClient(clientID, clientSecret string) error {
+	if expected, ok := s.cfg.IntrospectionClients[clientID]; ok {
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(clientSecret)) == 1 {
+			return nil
+		}
+		logger.Error("Client authentication failed for: ", clientID)
+		return errors.New("invalid client")
+	}
+
+	client, err := s.ResolveClient(clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+	if !client.IsConfidential() {
+		logger.Error("Public client attempted authenticated request: ", clientID)
+		return errors.New("invalid client")
+	}
+	return nil
+}
+
+// ResolveClient looks up a registered client, checking the secret of
+// confidential clients. Public clients are identified by client_id alone.
+func (s *oauthService) ResolveClient(clientID, clientSecret string) (*models.OAuthClient, error) {
+	client, err := s.clientRepo.GetClientByID(clientID)
+	if err != nil {
+		return nil, newOAuthError("invalid_client", "unknown client")
+	}
+
+	if client.IsConfidential() {
+		if err := bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(clientSecret)); err != nil {
+			logger.Error("Client authentication failed for: ", clientID)
+			return nil, newOAuthError("invalid_client", "client authentication failed")
+		}
+	} else if clientSecret != "" {
+		return nil, newOAuthError("invalid_client", "public clients must not send a secret")
+	}
+
+	return client, nil
+}
+
+func (s *oauthService) Introspect(token, tokenTypeHint string) (*Introspection, error) {
+	claims, err := s.authService.IntrospectToken(token, tokenTypeHint)
+	if err != nil {
+		logger.Debug("Introspected token is inactive: ", err)
+		return &Introspection{Active: false}, nil
+	}
+
+	result := &Introspection{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		TokenType: "Bearer",
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		JTI:       claims.ID,
+		Role:      claims.Role,
+		Cnf:       claims.Cnf,
+	}
+	if claims.TokenUse == models.TokenUseRefresh {
+		result.TokenType = "refresh_token"
+	} else if claims.Cnf != nil {
+		result.TokenType = "DPoP"
+	}
+	if claims.ExpiresAt != nil {
+		result.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		result.Iat = claims.IssuedAt.Unix()
+	}
+	return result, nil
+}
+
+func (s *oauthService) Revoke(client *models.OAuthClient, token, tokenTypeHint string) error {
+	return s.authService.RevokeToken(token, tokenTypeHint, client)
+}
+
+// ParseAuthorizationRequest returns a nil request when the client or redirect
+// URI cannot be trusted; those errors must be shown to the user instead of
+// being redirected back to the client.
+func (s *oauthService) ParseAuthorizationRequest(params url.Values) (*AuthorizationRequest, error) {
+	client, err := s.clientRepo.GetClientByID(params.Get("client_id"))
+	if err != nil {
+		return nil, newOAuthError("invalid_client", "unknown client")
+	}
+
+	redirectURI := params.Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		return nil, newOAuthError("invalid_request", "redirect_uri is not registered for this client")
+	}
+
+	req := &AuthorizationRequest{
+		Client:              client,
+		RedirectURI:         redirectURI,
+		State:               params.Get("state"),
+		CodeChallenge:       params.Get("code_challenge"),
+		CodeChallengeMethod: params.Get("code_challenge_method"),
+		Nonce:               params.Get("nonce"),
+	}
+
+	if params.Get("response_type") != "code" {
+		return req, newOAuthError("unsupported_response_type", "only the code response type is supported")
+	}
+
+	req.Scope, err = resolveScope(client, params.Get("scope"))
+	if err != nil {
+		return req, err
+	}
+
+	if req.CodeChallenge == "" {
+		return req, newOAuthError("invalid_request", "code_challenge is required")
+	}
+	if req.CodeChallengeMethod != "S256" {
+		return req, newOAuthError("invalid_request", "code_challenge_method must be S256")
+	}
+
+	return req, nil
+}
+
+func (s *oauthService) Authorize(req *AuthorizationRequest, email, password string) (string, error) {
+	user, err := s.authService.Authenticate(email, password)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := generateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.codeRepo.CreateCode(&models.AuthorizationCode{
+		Code:                code,
+		ClientID:            req.Client.ID,
+		UserID:              user.ID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		ExpiresAt:           time.Now().Add(authorizationCodeTTL),
+	}); err != nil {
+		return "", err
+	}
+
+	logger.Info("Authorization code issued to client ", req.Client.ID, " for user ", user.Email)
+	return code, nil
+}
+
+func (s *oauthService) ExchangeAuthorizationCode(clientID, code, redirectURI, codeVerifier string) (*TokenPair, error) {
+	stored, err := s.codeRepo.GetCode(code)
+	if err != nil {
+		return nil, newOAuthError("invalid_grant", "invalid authorization code")
+	}
+
+	if stored.ClientID != clientID || stored.RedirectURI != redirectURI {
+		logger.Error("Authorization code presented by wrong client or redirect URI: ", clientID)
+		return nil, newOAuthError("invalid_grant", "authorization code was issued to another client or redirect_uri")
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, newOAuthError("invalid_grant", "authorization code expired")
+	}
+
+	fresh, err := s.codeRepo.MarkCodeUsed(code)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		logger.Error("Authorization code replayed by client ", clientID)
+		return nil, newOAuthError("invalid_grant", "authorization code already used")
+	}
+
+	if !verifyCodeChallenge(stored.CodeChallenge, codeVerifier) {
+		logger.Error("PKCE verification failed for client ", clientID)
+		return nil, newOAuthError("invalid_grant", "code_verifier does not match code_challenge")
+	}
+
+	user, err := s.authService.GetUserByID(stored.UserID)
+	if err != nil || !user.IsActive {
+		return nil, newOAuthError("invalid_grant", "user is no longer active")
+	}
+
+	return s.authService.IssueTokens(user, clientID, stored.Scope, stored.Nonce)
+}
+
+// RefreshToken leaves client binding, rotation and reuse detection to
+// AuthService.Refresh so a replayed token revokes its session here too.
+func (s *oauthService) RefreshToken(client *models.OAuthClient, refreshToken string) (*TokenPair, error) {
+	tokens, err := s.authService.Refresh(refreshToken, client, nil)
+	if err != nil {
+		return nil, newOAuthError("invalid_grant", err.Error())
+	}
+	return tokens, nil
+}
+
+func (s *oauthService) ClientCredentials(client *models.OAuthClient, scope string) (*TokenPair, error) {
+	if !client.IsConfidential() {
+		return nil, newOAuthError("unauthorized_client", "only confidential clients may use client_credentials")
+	}
+
+	scope, err := resolveScope(client, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.authService.IssueClientToken(client, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Client credentials token issued to ", client.ID)
+	return tokens, nil
+}
+
+type TokenExchangeRequest struct {
+	SubjectToken       string
+	SubjectTokenType   string
+	RequestedTokenType string
+	Scope              string
+	Audience           []string
+}
+
+// ExchangeToken implements RFC 8693 token exchange: a confidential client
+// swaps a user's access token for a narrower one naming the client as actor.
+func (s *oauthService) ExchangeToken(client *models.OAuthClient, req *TokenExchangeRequest) (*TokenPair, error) {
+	if !client.IsConfidential() {
+		return nil, newOAuthError("unauthorized_client", "only confidential clients may exchange tokens")
+	}
+	if req.SubjectToken == "" || req.SubjectTokenType != TokenTypeAccessToken {
+		return nil, newOAuthError("invalid_request", "subject_token must be an access token")
+	}
+	if req.RequestedTokenType != "" && req.RequestedTokenType != TokenTypeAccessToken {
+		return nil, newOAuthError("invalid_request", "only access tokens can be requested")
+	}
+
+	subject, err := s.authService.ValidateToken(req.SubjectToken)
+	if err != nil {
+		logger.Error("Token exchange rejected for client ", client.ID, ": ", err)
+		return nil, newOAuthError("invalid_request", "invalid subject token")
+	}
+
+	allowed := client.Scopes
+	if subject.Scope != "" {
+		allowed = slices.DeleteFunc(slices.Clone(allowed), func(scope string) bool {
+			return !hasScope(subject.Scope, scope)
+		})
+	}
+
+	scope := strings.Join(allowed, " ")
+	if req.Scope != "" {
+		for _, requested := range strings.Fields(req.Scope) {
+			if !slices.Contains(allowed, requested) {
+				return nil, newOAuthError("invalid_scope", "scope "+requested+" is not allowed")
+			}
+		}
+		scope = strings.Join(strings.Fields(req.Scope), " ")
+	}
+
+	tokens, err := s.authService.IssueDelegatedToken(subject, client, scope, req.Audience)
+	if err != nil {
+		return nil, err
+	}
+	tokens.IssuedTokenType = TokenTypeAccessToken
+	return tokens, nil
+}
+
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+func (s *oauthService) StartDeviceAuthorization(client *models.OAuthClient, scope string) (*DeviceAuthorization, error) {
+	scope, err := resolveScope(client, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceCode, err := generateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.deviceRepo.CreateCode(&models.DeviceCode{
+		DeviceCode: deviceCode,
+		UserCode:   userCode,
+		ClientID:   client.ID,
+		Scope:      scope,
+		Interval:   devicePollInterval,
+		ExpiresAt:  time.Now().Add(deviceCodeTTL),
+	}); err != nil {
+		return nil, err
+	}
+
+	verificationURI := s.cfg.BaseURL + "/oauth/device"
+	logger.Info("Device authorization started for client ", client.ID)
+	return &DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               int64(deviceCodeTTL.Seconds()),
+		Interval:                devicePollInterval,
+	}, nil
+}
+
+func (s *oauthService) GetDeviceAuthorization(userCode string) (*models.DeviceCode, *models.OAuthClient, error) {
+	dc, err := s.deviceRepo.GetByUserCode(normalizeUserCode(userCode))
+	if err != nil || dc.Status != models.DeviceCodePending || time.Now().After(dc.ExpiresAt) {
+		return nil, nil, errors.New("invalid or expired code")
+	}
+
+	client, err := s.clientRepo.GetClientByID(dc.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dc, client, nil
+}
+
+func (s *oauthService) CompleteDeviceAuthorization(userCode, email, password string, approved bool) (*models.OAuthClient, error) {
+	dc, client, err := s.GetDeviceAuthorization(userCode)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.authService.Authenticate(email, password)
+	if err != nil {
+		return nil, err
+	}
+
+	status := models.DeviceCodeApproved
+	if !approved {
+		status = models.DeviceCodeDenied
+	}
+
+	resolved, err := s.deviceRepo.Resolve(dc.UserCode, user.ID, status)
+	if err != nil {
+		return nil, err
+	}
+	if !resolved {
+		return nil, errors.New("invalid or expired code")
+	}
+
+	logger.Info("Device code for client ", client.ID, " ", status, " by user ", user.Email)
+	return client, nil
+}
+
+func (s *oauthService) PollDeviceToken(client *models.OAuthClient, deviceCode string) (*TokenPair, error) {
+	dc, err := s.deviceRepo.GetByDeviceCode(deviceCode)
+	if err != nil || dc.ClientID != client.ID {
+		return nil, newOAuthError("invalid_grant", "invalid device code")
+	}
+
+	now := time.Now()
+	if now.After(dc.ExpiresAt) {
+		return nil, newOAuthError("expired_token", "device code expired")
+	}
+
+	if dc.LastPolledAt != nil && now.Sub(*dc.LastPolledAt) < time.Duration(dc.Interval)*time.Second {
+		if err := s.deviceRepo.RecordPoll(dc.ID, now, dc.Interval+devicePollInterval); err != nil {
+			return nil, err
+		}
+		return nil, newOAuthError("slow_down", "polling too frequently")
+	}
+	if err := s.deviceRepo.RecordPoll(dc.ID, now, dc.Interval); err != nil {
+		return nil, err
+	}
+
+	switch dc.Status {
+	case models.DeviceCodePending:
+		return nil, newOAuthError("authorization_pending", "the user has not yet approved the request")
+	case models.DeviceCodeDenied:
+		return nil, newOAuthError("access_denied", "the user denied the request")
+	case models.DeviceCodeConsumed:
+		return nil, newOAuthError("invalid_grant", "device code already used")
+	}
+
+	consumed, err := s.deviceRepo.MarkConsumed(dc.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed || dc.UserID == nil {
+		return nil, newOAuthError("invalid_grant", "device code already used")
+	}
+
+	user, err := s.authService.GetUserByID(*dc.UserID)
+	if err != nil || !user.IsActive {
+		return nil, newOAuthError("invalid_grant", "user is no longer active")
+	}
+
+	return s.authService.IssueTokens(user, client.ID, dc.Scope, "")
+}
+
+// generateUserCode returns a code like "BDFG-HJKL" drawn from consonants only,
+// so it is easy to type and cannot spell words.
+func generateUserCode() (string, error) {
+	// Bytes past the largest multiple of the alphabet size are discarded so
+	// that every letter is equally likely.
+	limit := 256 - 256%len(userCodeAlphabet)
+	code := make([]byte, 0, 9)
+	b := make([]byte, 16)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			logger.Error("Error generating user code: ", err)
+			return "", err
+		}
+		for _, v := range b {
+			if int(v) >= limit {
+				continue
+			}
+			if len(code) == 4 {
+				code = append(code, '-')
+			}
+			code = append(code, userCodeAlphabet[int(v)%len(userCodeAlphabet)])
+			if len(code) == cap(code) {
+				return string(code), nil
+			}
+		}
+	}
+}
+
+func normalizeUserCode(userCode string) string {
+	code := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(userCode))
+	if len(code) != 8 {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
+
+func resolveScope(client *models.OAuthClient, requested string) (string, error) {
+	if requested == "" {
+		return strings.Join(client.Scopes, " "), nil
+	}
+
+	for _, scope := range strings.Fields(requested) {
+		if !slices.Contains(client.Scopes, scope) {
+			return "", newOAuthError("invalid_scope", "scope "+scope+" is not allowed for this client")
+		}
+	}
+	return strings.Join(strings.Fields(requested), " "), nil
+}
+
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"authforge/config"
+	"authforge/internal/models"
+)
+
+func TestRefreshTokenClientBinding(t *testing.T) {
+	public := &models.OAuthClient{ID: "spa"}
+	confidential := &models.OAuthClient{ID: "backend", SecretHash: "hash"}
+	other := &models.OAuthClient{ID: "other", SecretHash: "hash"}
+
+	tests := []struct {
+		name     string
+		issuedTo string
+		redeemer *models.OAuthClient
+		wantErr  bool
+	}{
+		{name: "public client redeems its own token", issuedTo: "spa", redeemer: public},
+		{name: "confidential client redeems its own token", issuedTo: "backend", redeemer: confidential},
+		{name: "token of another client", issuedTo: "backend", redeemer: other, wantErr: true},
+		{name: "public client token redeemed by another client", issuedTo: "spa", redeemer: confidential, wantErr: true},
+		{name: "first-party token at the token endpoint", issuedTo: "", redeemer: public, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestAuthService(t)
+			for _, client := range []*models.OAuthClient{public, confidential, other} {
+				ts.clients.clients[client.ID] = client
+			}
+			oauth := NewOAuthService(ts, ts.clients, nil, nil, ts.cfg)
+
+			pair, err := ts.IssueTokens(ts.addUser(), tt.issuedTo, "openid", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = oauth.RefreshToken(tt.redeemer, pair.RefreshToken)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("refresh failed: %v", err)
+				}
+				return
+			}
+
+			var oauthErr *OAuthError
+			if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+				t.Fatalf("got error %v, want invalid_grant", err)
+			}
+
+			// A rejected attempt must not burn the token for its rightful client.
+			if _, err := ts.Refresh(pair.RefreshToken, ts.clients.clients[tt.issuedTo], nil); err != nil {
+				t.Fatalf("token unusable by its client after a rejected attempt: %v", err)
+			}
+		})
+	}
+}
+
+func TestRevokeClientBinding(t *testing.T) {
+	public := &models.OAuthClient{ID: "spa"}
+	confidential := &models.OAuthClient{ID: "backend", SecretHash: "hash"}
+
+	tests := []struct {
+		name        string
+		issuedTo    string
+		caller      *models.OAuthClient
+		refresh     bool
+		wantRevoked bool
+	}{
+		{name: "public client revokes its refresh token", issuedTo: "spa", caller: public, refresh: true, wantRevoked: true},
+		{name: "confidential client revokes its access token", issuedTo: "backend", caller: confidential, wantRevoked: true},
+		{name: "refresh token of another client", issuedTo: "spa", caller: confidential, refresh: true},
+		{name: "access token of another client", issuedTo: "backend", caller: public},
+		{name: "first-party refresh token", issuedTo: "", caller: confidential, refresh: true},
+		{name: "first-party access token", issuedTo: "", caller: confidential},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestAuthService(t)
+			ts.clients.clients[public.ID] = public
+			ts.clients.clients[confidential.ID] = confidential
+			oauth := NewOAuthService(ts, ts.clients, nil, nil, ts.cfg)
+
+			pair, err := ts.IssueTokens(ts.addUser(), tt.issuedTo, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, hint := pair.AccessToken, "access_token"
+			if tt.refresh {
+				token, hint = pair.RefreshToken, "refresh_token"
+			}
+			if err := oauth.Revoke(tt.caller, token, hint); err != nil {
+				t.Fatalf("revocation failed: %v", err)
+			}
+
+			claims, err := ts.decodeToken(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			revoked := ts.revoked.revoked[claims.ID]
+			if tt.refresh {
+				revoked = ts.sessionOf(t, token).RevokedAt != nil
+			}
+			if revoked != tt.wantRevoked {
+				t.Fatalf("revoked = %v, want %v", revoked, tt.wantRevoked)
+			}
+		})
+	}
+}
+
+func TestGenerateUserCode(t *testing.T) {
+	for range 1000 {
+		code, err := generateUserCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != 9 || code[4] != '-' {
+			t.Fatalf("code %q is not formatted like BDFG-HJKL", code)
+		}
+		for i, c := range code {
+			if i != 4 && !strings.ContainsRune(userCodeAlphabet, c) {
+				t.Fatalf("code %q contains %q, which is not in the alphabet", code, c)
+			}
+		}
+		if normalizeUserCode(strings.ToLower(strings.ReplaceAll(code, "-", ""))) != code {
+			t.Fatalf("code %q does not survive normalization", code)
+		}
+	}
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// RFC 7636, Appendix B.
+	const (
+		rfcVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		rfcChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	)
+	challengeOf := func(verifier string) string {
+		sum := sha256.Sum256([]byte(verifier))
+		return base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	tests := []struct {
+		name      string
+		challenge string
+		verifier  string
+		want      bool
+	}{
+		{name: "RFC 7636 example", challenge: rfcChallenge, verifier: rfcVerifier, want: true},
+		{name: "wrong verifier", challenge: rfcChallenge, verifier: strings.Repeat("a", 43)},
+		{name: "43 characters", challenge: challengeOf(strings.Repeat("a", 43)), verifier: strings.Repeat("a", 43), want: true},
+		{name: "128 characters", challenge: challengeOf(strings.Repeat("a", 128)), verifier: strings.Repeat("a", 128), want: true},
+		{name: "42 characters", challenge: challengeOf(strings.Repeat("a", 42)), verifier: strings.Repeat("a", 42)},
+		{name: "129 characters", challenge: challengeOf(strings.Repeat("a", 129)), verifier: strings.Repeat("a", 129)},
+		{name: "empty challenge", challenge: "", verifier: rfcVerifier},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyCodeChallenge(tt.challenge, tt.verifier); got != tt.want {
+				t.Fatalf("verifyCodeChallenge = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type fakeAuthorizationCodeRepo struct {
+	codes map[string]*models.AuthorizationCode
+}
+
+func (r *fakeAuthorizationCodeRepo) CreateCode(code *models.AuthorizationCode) error {
+	r.codes[code.Code] = code
+	return nil
+}
+
+func (r *fakeAuthorizationCodeRepo) GetCode(code string) (*models.AuthorizationCode, error) {
+	stored, ok := r.codes[code]
+	if !ok {
+		return nil, errors.New("authorization code not found")
+	}
+	return stored, nil
+}
+
+func (r *fakeAuthorizationCodeRepo) MarkCodeUsed(code string) (bool, error) {
+	stored := r.codes[code]
+	if stored.Used {
+		return false, nil
+	}
+	stored.Used = true
+	return true, nil
+}
+
+func TestParseAuthorizationRequest(t *testing.T) {
+	client := &models.OAuthClient{
+		ID:           "spa",
+		RedirectURIs: []string{"https://app.example.com/callback"},
+		Scopes:       []string{"openid", "email"},
+	}
+	valid := func() url.Values {
+		return url.Values{
+			"client_id":             {"spa"},
+			"response_type":         {"code"},
+			"redirect_uri":          {"https://app.example.com/callback"},
+			"scope":                 {"openid"},
+			"code_challenge":        {"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"},
+			"code_challenge_method": {"S256"},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		edit     func(url.Values)
+		wantCode string
+	}{
+		{name: "valid request", edit: func(url.Values) {}},
+		{name: "single redirect_uri is implied", edit: func(v url.Values) { v.Del("redirect_uri") }},
+		{name: "unknown client", edit: func(v url.Values) { v.Set("client_id", "other") }, wantCode: "invalid_client"},
+		{name: "unregistered redirect_uri", edit: func(v url.Values) { v.Set("redirect_uri", "https://evil.example.com/") }, wantCode: "invalid_request"},
+		{name: "implicit flow", edit: func(v url.Values) { v.Set("response_type", "token") }, wantCode: "unsupported_response_type"},
+		{name: "scope not allowed", edit: func(v url.Values) { v.Set("scope", "openid admin") }, wantCode: "invalid_scope"},
+		{name: "missing code_challenge", edit: func(v url.Values) { v.Del("code_challenge") }, wantCode: "invalid_request"},
+		{name: "plain code_challenge_method", edit: func(v url.Values) { v.Set("code_challenge_method", "plain") }, wantCode: "invalid_request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clients := &fakeClientRepo{clients: map[string]*models.OAuthClient{client.ID: client}}
+			oauth := NewOAuthService(nil, clients, nil, nil, &config.Config{})
+
+			params := valid()
+			tt.edit(params)
+			_, err := oauth.ParseAuthorizationRequest(params)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("request rejected: %v", err)
+				}
+				return
+			}
+			var oauthErr *OAuthError
+			if !errors.As(err, &oauthErr) || oauthErr.Code != tt.wantCode {
+				t.Fatalf("got error %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestExchangeAuthorizationCode(t *testing.T) {
+	const (
+		redirectURI = "https://app.example.com/callback"
+		verifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		challenge   = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	)
+
+	tests := []struct {
+		name        string
+		clientID    string
+		redirectURI string
+		verifier    string
+		expired     bool
+		used        bool
+		inactive    bool
+		wantErr     bool
+	}{
+		{name: "valid exchange", clientID: "spa", redirectURI: redirectURI, verifier: verifier},
+		{name: "another client", clientID: "other", redirectURI: redirectURI, verifier: verifier, wantErr: true},
+		{name: "another redirect_uri", clientID: "spa", redirectURI: "https://app.example.com/other", verifier: verifier, wantErr: true},
+		{name: "wrong code_verifier", clientID: "spa", redirectURI: redirectURI, verifier: strings.Repeat("a", 43), wantErr: true},
+		{name: "expired code", clientID: "spa", redirectURI: redirectURI, verifier: verifier, expired: true, wantErr: true},
+		{name: "code already used", clientID: "spa", redirectURI: redirectURI, verifier: verifier, used: true, wantErr: true},
+		{name: "deactivated user", clientID: "spa", redirectURI: redirectURI, verifier: verifier, inactive: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestAuthService(t)
+			ts.clients.clients["spa"] = &models.OAuthClient{ID: "spa", RedirectURIs: []string{redirectURI}}
+			codes := &fakeAuthorizationCodeRepo{codes: make(map[string]*models.AuthorizationCode)}
+			oauth := NewOAuthService(ts, ts.clients, codes, nil, ts.cfg)
+
+			user := ts.addUser()
+			user.IsActive = !tt.inactive
+			expiresAt := time.Now().Add(authorizationCodeTTL)
+			if tt.expired {
+				expiresAt = time.Now().Add(-time.Second)
+			}
+			codes.codes["code"] = &models.AuthorizationCode{
+				Code:                "code",
+				ClientID:            "spa",
+				UserID:              user.ID,
+				RedirectURI:         redirectURI,
+				Scope:               "openid email",
+				CodeChallenge:       challenge,
+				CodeChallengeMethod: "S256",
+				ExpiresAt:           expiresAt,
+				Used:                tt.used,
+			}
+
+			pair, err := oauth.ExchangeAuthorizationCode(tt.clientID, "code", tt.redirectURI, tt.verifier)
+			if tt.wantErr {
+				var oauthErr *OAuthError
+				if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+					t.Fatalf("got error %v, want invalid_grant", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("exchange failed: %v", err)
+			}
+
+			claims, err := ts.decodeToken(pair.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.ClientID != "spa" || claims.Scope != "openid email" || claims.UserID != user.ID.String() {
+				t.Fatalf("token issued to client %q for %q with scope %q", claims.ClientID, claims.UserID, claims.Scope)
+			}
+			if _, err := oauth.ExchangeAuthorizationCode(tt.clientID, "code", tt.redirectURI, tt.verifier); err == nil {
+				t.Fatal("code redeemed twice")
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package tokenformat
+
+import (
+	"fmt"
+	"strings"
+
+	"authforge/internal/keyring"
+	"authforge/internal/models"
+)
+
+const (
+	FormatJWT    = "jwt"
+	FormatPASETO = "paseto"
+)
+
+// Format turns access and refresh token claims into a signed string and back.
+type Format interface {
+	Sign(claims *models.CustomClaims) (string, error)
+	Parse(token string) (*models.CustomClaims, error)
+}
+
+// New returns the format named by TOKEN_FORMAT, checking that the active
+// signing key can be used with it.
+func New(name string, keys *keyring.Keyring) (Format, error) {
+	if err := CheckSigningKey(name, keys); err != nil {
+		return nil, err
+	}
+
+	if name == FormatPASETO {
+		return &PASETO{Keys: keys}, nil
+	}
+	return &JWT{Keys: keys}, nil
+}
+
+// CheckSigningKey reports whether the active key of keys can sign tokens in
+// the named format. Reloaded keyrings must pass it before they replace the
+// running one.
+func CheckSigningKey(name string, keys *keyring.Keyring) error {
+	switch name {
+	case "", FormatJWT:
+		return nil
+	case FormatPASETO:
+		if keys.SigningKey().Algorithm != pasetoAlgorithm {
+			return fmt.Errorf("TOKEN_FORMAT=paseto needs an Ed25519 signing key, active key %q is %s", keys.SigningKey().ID, keys.SigningKey().Algorithm)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown token format %q", name)
+	}
+}
+
+// ForToken picks the format a token was issued in, so tokens keep working
+// after TOKEN_FORMAT changes.
+func ForToken(token string, keys *keyring.Keyring) Format {
+	if strings.HasPrefix(token, pasetoHeader) {
+		return &PASETO{Keys: keys}
+	}
+	return &JWT{Keys: keys}
+}
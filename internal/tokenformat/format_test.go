@@ -0,0 +1,45 @@
+package tokenformat
+
+import (
+	"testing"
+
+	"authforge/internal/keyring"
+)
+
+func newKeyring(t *testing.T, alg string) *keyring.Keyring {
+	t.Helper()
+	key, err := keyring.Generate(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := keyring.New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestCheckSigningKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		alg     string
+		wantErr bool
+	}{
+		{name: "default format with ES256", format: "", alg: "ES256"},
+		{name: "jwt with EdDSA", format: FormatJWT, alg: "EdDSA"},
+		{name: "paseto with EdDSA", format: FormatPASETO, alg: "EdDSA"},
+		{name: "paseto with ES256", format: FormatPASETO, alg: "ES256", wantErr: true},
+		{name: "paseto with RS256", format: FormatPASETO, alg: "RS256", wantErr: true},
+		{name: "unknown format", format: "macaroon", alg: "EdDSA", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckSigningKey(tt.format, newKeyring(t, tt.alg))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package tokenformat
+
+import (
+	"errors"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"authforge/internal/keyring"
+	"authforge/internal/models"
+)
+
+type JWT struct {
+	Keys *keyring.Keyring
+}
+
+func (f *JWT) Sign(claims *models.CustomClaims) (string, error) {
+	return f.SignClaims(claims)
+}
+
+// SignClaims signs any claims set with the active key, which is also how ID
+// tokens are issued regardless of TOKEN_FORMAT.
+func (f *JWT) SignClaims(claims jwt.Claims) (string, error) {
+	key := f.Keys.SigningKey()
+	token := jwt.NewWithClaims(key.Method(), claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.PrivateKey)
+}
+
+func (f *JWT) Parse(tokenString string) (*models.CustomClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &models.CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := f.Keys.Lookup(kid)
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.PublicKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*models.CustomClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,159 @@
+package tokenformat
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"authforge/internal/keyring"
+	"authforge/internal/models"
+)
+
+const (
+	pasetoHeader    = "v4.public."
+	pasetoAlgorithm = "EdDSA"
+)
+
+// PASETO issues v4.public tokens. There is no algorithm header to tamper
+// with: v4.public is always Ed25519, and the key id travels in the footer.
+type PASETO struct {
+	Keys *keyring.Keyring
+}
+
+type pasetoFooter struct {
+	KeyID string `json:"kid"`
+}
+
+// PASETO timestamps are RFC 3339 strings rather than JWT numeric dates.
+var pasetoTimeClaims = []string{"exp", "iat", "nbf"}
+
+func (f *PASETO) Sign(claims *models.CustomClaims) (string, error) {
+	key := f.Keys.SigningKey()
+	privateKey, ok := key.PrivateKey.(ed25519.PrivateKey)
+	if !ok {
+		return "", errors.New("PASETO v4.public needs an Ed25519 signing key")
+	}
+
+	payload, err := encodePayload(claims)
+	if err != nil {
+		return "", err
+	}
+	footer, err := json.Marshal(pasetoFooter{KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+
+	sig := ed25519.Sign(privateKey, pae([]byte(pasetoHeader), payload, footer, nil))
+	return pasetoHeader +
+		base64.RawURLEncoding.EncodeToString(append(payload, sig...)) + "." +
+		base64.RawURLEncoding.EncodeToString(footer), nil
+}
+
+func (f *PASETO) Parse(token string) (*models.CustomClaims, error) {
+	if !strings.HasPrefix(token, pasetoHeader) {
+		return nil, errors.New("not a v4.public token")
+	}
+
+	body, encodedFooter, _ := strings.Cut(strings.TrimPrefix(token, pasetoHeader), ".")
+	signed, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil || len(signed) < ed25519.SignatureSize {
+		return nil, errors.New("invalid token")
+	}
+	footer, err := base64.RawURLEncoding.DecodeString(encodedFooter)
+	if err != nil {
+		return nil, errors.New("invalid token")
+	}
+
+	var meta pasetoFooter
+	if len(footer) > 0 {
+		if err := json.Unmarshal(footer, &meta); err != nil {
+			return nil, errors.New("invalid token footer")
+		}
+	}
+	key, ok := f.Keys.Lookup(meta.KeyID)
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	publicKey, ok := key.PublicKey.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("unexpected signing key type")
+	}
+
+	payload := signed[:len(signed)-ed25519.SignatureSize]
+	sig := signed[len(signed)-ed25519.SignatureSize:]
+	if !ed25519.Verify(publicKey, pae([]byte(pasetoHeader), payload, footer, nil), sig) {
+		return nil, errors.New("invalid token signature")
+	}
+
+	return decodePayload(payload)
+}
+
+func encodePayload(claims *models.CustomClaims) ([]byte, error) {
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	for _, name := range pasetoTimeClaims {
+		if n, ok := fields[name].(json.Number); ok {
+			secs, err := n.Int64()
+			if err != nil {
+				return nil, err
+			}
+			fields[name] = time.Unix(secs, 0).UTC().Format(time.RFC3339)
+		}
+	}
+	return json.Marshal(fields)
+}
+
+func decodePayload(payload []byte) (*models.CustomClaims, error) {
+	var fields map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return nil, errors.New("invalid token payload")
+	}
+	for _, name := range pasetoTimeClaims {
+		if s, ok := fields[name].(string); ok {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return nil, errors.New("invalid " + name + " claim")
+			}
+			fields[name] = jwt.NewNumericDate(t)
+		}
+	}
+
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	claims := &models.CustomClaims{}
+	if err := json.Unmarshal(raw, claims); err != nil {
+		return nil, errors.New("invalid token payload")
+	}
+	return claims, nil
+}
+
+// pae is the pre-authentication encoding every PASETO signature covers.
+func pae(pieces ...[]byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint64(len(pieces)))
+	for _, piece := range pieces {
+		binary.Write(&buf, binary.LittleEndian, uint64(len(piece)))
+		buf.Write(piece)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,111 @@
+package tokenformat
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"authforge/internal/keyring"
+	"authforge/internal/models"
+)
+
+func testClaims() *models.CustomClaims {
+	now := time.Now().Truncate(time.Second)
+	return &models.CustomClaims{
+		UserID:    "user-1",
+		Role:      string(models.RoleUser),
+		TokenUse:  models.TokenUseAccess,
+		SessionID: "session-1",
+		Scope:     "openid email",
+		Version:   3,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "jti-1",
+			Issuer:    "https://auth.example.com",
+			Subject:   "user-1",
+			Audience:  jwt.ClaimStrings{"api"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(15 * time.Minute)),
+		},
+	}
+}
+
+func TestPASETORoundTrip(t *testing.T) {
+	f := &PASETO{Keys: newKeyring(t, "EdDSA")}
+	want := testClaims()
+
+	token, err := f.Sign(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, pasetoHeader) {
+		t.Fatalf("token %q is not v4.public", token)
+	}
+
+	got, err := f.Parse(token)
+	if err != nil {
+		t.Fatalf("token rejected: %v", err)
+	}
+	if got.UserID != want.UserID || got.Role != want.Role || got.TokenUse != want.TokenUse ||
+		got.SessionID != want.SessionID || got.Scope != want.Scope || got.Version != want.Version ||
+		got.ID != want.ID || got.Issuer != want.Issuer || got.Subject != want.Subject {
+		t.Fatalf("parsed claims %+v, want %+v", got, want)
+	}
+	if !got.ExpiresAt.Equal(want.ExpiresAt.Time) || !got.IssuedAt.Equal(want.IssuedAt.Time) {
+		t.Fatalf("parsed exp %v iat %v, want %v %v", got.ExpiresAt, got.IssuedAt, want.ExpiresAt, want.IssuedAt)
+	}
+	if len(got.Audience) != 1 || got.Audience[0] != "api" {
+		t.Fatalf("parsed aud %v, want [api]", got.Audience)
+	}
+}
+
+func TestPASETORejects(t *testing.T) {
+	keys := newKeyring(t, "EdDSA")
+	f := &PASETO{Keys: keys}
+	token, err := f.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, footer, _ := strings.Cut(strings.TrimPrefix(token, pasetoHeader), ".")
+
+	signed, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed[0] ^= 1
+	tamperedPayload := pasetoHeader + base64.RawURLEncoding.EncodeToString(signed) + "." + footer
+
+	otherKey, err := keyring.Generate("EdDSA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherFooter := base64.RawURLEncoding.EncodeToString([]byte(`{"kid":"` + otherKey.ID + `"}`))
+	// The other key is trusted for verification, but did not sign the token.
+	wrongKey, err := keyring.New(keys.SigningKey(), otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		keys  *keyring.Keyring
+		token string
+	}{
+		{name: "tampered payload", keys: keys, token: tamperedPayload},
+		{name: "footer names another trusted key", keys: wrongKey, token: pasetoHeader + body + "." + otherFooter},
+		{name: "signed by a key that is not trusted", keys: newKeyring(t, "EdDSA"), token: token},
+		{name: "footer stripped", keys: keys, token: pasetoHeader + body},
+		{name: "local purpose", keys: keys, token: "v4.local." + body + "." + footer},
+		{name: "truncated", keys: keys, token: pasetoHeader + body[:20] + "." + footer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := (&PASETO{Keys: tt.keys}).Parse(tt.token); err == nil {
+				t.Fatal("token accepted, want an error")
+			}
+		})
+	}
+}
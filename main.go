@@ -1,7 +1,15 @@
 package main
 
-import "authforge/cmd"
+import (
+	"os"
+
+	"authforge/cmd"
+)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		cmd.Keys(os.Args[2:])
+		return
+	}
 	cmd.Run()
 }